@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"example.com/portfolio-backend/controllers"
+)
+
+// runBenchCommand implements the `bench` subcommand: it embeds the snapshot files, replicates
+// them to a realistic index size and compares float32 vectors scored serially with int8
+// vectors scored in parallel, using the golden set questions as queries.
+func runBenchCommand(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	goldenPath := fs.String("golden", "data/eval/golden-set.json", "golden question set whose questions are the benchmark queries")
+	snapshotDir := fs.String("snapshots", "", "directory with db-context.json, github-context.json and resume-context.json (required), e.g. \"../AI-Chat-Bot-Data Best Version/data\"")
+	providerName := fs.String("provider", "fake", "embedding/chat provider: fake or openai")
+	embedderName := fs.String("embedder", "provider", "embedder: provider (embed with -provider) or local (offline TF-IDF)")
+	replicate := fs.Int("replicate", 50, "copies of the snapshot index to score against")
+	rounds := fs.Int("rounds", 20, "times every query is scored")
+	k := fs.Int("k", 5, "cut-off for the top-k agreement with exact scoring")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *snapshotDir == "" {
+		return fmt.Errorf("-snapshots is required")
+	}
+	if err := selectProviders(*providerName, *embedderName); err != nil {
+		return err
+	}
+
+	set, err := controllers.LoadGoldenSet(*goldenPath)
+	if err != nil {
+		return err
+	}
+	queries := make([]string, 0, len(set.Questions))
+	for _, q := range set.Questions {
+		queries = append(queries, q.Question)
+	}
+	report, err := controllers.RunVectorBenchmark(context.Background(), *snapshotDir, queries,
+		controllers.VectorBenchOptions{Replicate: *replicate, Rounds: *rounds, K: *k})
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	fmt.Print(controllers.FormatVectorBenchReport(report))
+	return nil
+}
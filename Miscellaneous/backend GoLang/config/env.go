@@ -0,0 +1,59 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// EnvFloat reads a float64 from the environment, falling back to def when unset or invalid.
+func EnvFloat(name string, def float64) float64 {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return def
+	}
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		log.Printf("Invalid %s=%q, using default %v", name, raw, def)
+		return def
+	}
+	return v
+}
+
+// EnvInt reads an int from the environment, falling back to def when unset or invalid.
+func EnvInt(name string, def int) int {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return def
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil {
+		log.Printf("Invalid %s=%q, using default %d", name, raw, def)
+		return def
+	}
+	return v
+}
+
+// EnvDuration reads a time.Duration (e.g. "24h", "90s") from the environment, falling back to
+// def when unset or invalid.
+func EnvDuration(name string, def time.Duration) time.Duration {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return def
+	}
+	v, err := time.ParseDuration(raw)
+	if err != nil {
+		log.Printf("Invalid %s=%q, using default %s", name, raw, def)
+		return def
+	}
+	return v
+}
+
+// EnvString reads a string from the environment, falling back to def when unset.
+func EnvString(name string, def string) string {
+	if raw := os.Getenv(name); raw != "" {
+		return raw
+	}
+	return def
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"os"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -25,6 +26,9 @@ var (
 
 	client *mongo.Client
 
+	// AdminCollection holds the hashed admin credentials in the primary DB
+	AdminCollection = os.Getenv("ADMIN_COLLECTION")
+
 	// Metrics counters for DB operations
 	dbOpsCount       int64
 	dbOpsByCollection = struct {
@@ -119,19 +123,66 @@ func (c *Collection) Aggregate(ctx context.Context, pipeline interface{}, opts .
 	return c.coll.Aggregate(ctx, pipeline, opts...)
 }
 
+// FindOneAndUpdate wraps mongo.Collection.FindOneAndUpdate and increments metrics.
+func (c *Collection) FindOneAndUpdate(ctx context.Context, filter interface{}, update interface{}, opts ...*options.FindOneAndUpdateOptions) *mongo.SingleResult {
+	c.metricIncrement()
+	return c.coll.FindOneAndUpdate(ctx, filter, update, opts...)
+}
+
+// CreateIndex creates an index on the collection; existing identical indexes are left as is.
+func (c *Collection) CreateIndex(ctx context.Context, model mongo.IndexModel) (string, error) {
+	return c.coll.Indexes().CreateOne(ctx, model)
+}
+
+// EnsureSearchIndex creates the named Atlas Search index of the given type ("search" or
+// "vectorSearch"), or updates its definition when it already exists.
+func (c *Collection) EnsureSearchIndex(ctx context.Context, name string, kind string, definition interface{}) error {
+	view := c.coll.SearchIndexes()
+	cursor, err := view.List(ctx, options.SearchIndexes().SetName(name))
+	if err != nil {
+		return err
+	}
+	var existing []struct {
+		Name string `bson:"name"`
+	}
+	if err := cursor.All(ctx, &existing); err != nil {
+		return err
+	}
+	if len(existing) > 0 {
+		return view.UpdateOne(ctx, name, definition)
+	}
+	_, err = view.CreateOne(ctx, mongo.SearchIndexModel{
+		Definition: definition,
+		Options:    options.SearchIndexes().SetName(name).SetType(kind),
+	})
+	return err
+}
+
+// Names used before MONGO_DB_NAME, MONGO_DB_NAME_AI and ADMIN_COLLECTION had to be set. They
+// remain the fallbacks so existing deployments keep their data, but are deprecated.
+const (
+	legacyPrimaryDbName   = "KartavyaPortfolioDB"
+	legacyAIDbName        = "KartavyaPortfolioDBAI"
+	legacyAdminCollection = "KartavyaPortfolio"
+)
+
+// legacyName returns value, or the deprecated fallback with a warning when it is not set.
+func legacyName(env string, value string, fallback string) string {
+	if value != "" {
+		return value
+	}
+	log.Printf("⚠️ %s is not set; falling back to the deprecated default %q. Set it explicitly.", env, fallback)
+	return fallback
+}
+
 // ConnectDB connects to MongoDB using the URI and initializes the primary and AI databases.
 func ConnectDB(uri string, dbName string, aiName string) error {
 	if uri == "" {
 		return fmt.Errorf("MONGO_URI must be provided")
 	}
-	primaryDbName = dbName
-	if primaryDbName == "" {
-		primaryDbName = "KartavyaPortfolioDB"
-	}
-	aiDbName = aiName
-	if aiDbName == "" {
-		aiDbName = "KartavyaPortfolioDBAI"
-	}
+	primaryDbName = legacyName("MONGO_DB_NAME", dbName, legacyPrimaryDbName)
+	aiDbName = legacyName("MONGO_DB_NAME_AI", aiName, legacyAIDbName)
+	AdminCollection = legacyName("ADMIN_COLLECTION", AdminCollection, legacyAdminCollection)
 
 	// Setup MongoDB client
 	clientOptions := options.Client().ApplyURI(uri)
@@ -200,3 +251,11 @@ func ResetDBMetrics() {
 	dbOpsByCollection.m = make(map[string]int64)
 	dbOpsByCollection.Unlock()
 }
+
+// PingDB checks that the MongoDB deployment is reachable.
+func PingDB(ctx context.Context) error {
+	if client == nil {
+		return fmt.Errorf("MongoDB is not connected")
+	}
+	return client.Ping(ctx, nil)
+}
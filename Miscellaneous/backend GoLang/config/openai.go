@@ -1,8 +1,12 @@
 package config
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 	"os"
+	"strconv"
+	"time"
 
 	openai "github.com/sashabaranov/go-openai"
 )
@@ -16,6 +20,56 @@ func InitOpenAI() error {
 	if apiKey == "" {
 		return fmt.Errorf("OPENAI_API_KEY must be set in .env")
 	}
-	OpenAIClient = openai.NewClient(apiKey)
+	cfg := openai.DefaultConfig(apiKey)
+	cfg.HTTPClient = &http.Client{Transport: retryAfterTransport{base: http.DefaultTransport}}
+	OpenAIClient = openai.NewClientWithConfig(cfg)
 	return nil
 }
+
+// RetryHint receives the Retry-After of a throttled or failed OpenAI response. The client's
+// errors don't carry response headers, so callers that want to honor it attach a hint to the
+// request context with WithRetryHint.
+type RetryHint struct {
+	After time.Duration
+}
+
+type retryHintKey struct{}
+
+// WithRetryHint returns a context whose OpenAI responses record their Retry-After in hint.
+func WithRetryHint(ctx context.Context, hint *RetryHint) context.Context {
+	return context.WithValue(ctx, retryHintKey{}, hint)
+}
+
+// retryAfterTransport copies the Retry-After of 429 and 5xx responses into the request's hint.
+type retryAfterTransport struct {
+	base http.RoundTripper
+}
+
+func (t retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || (resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500) {
+		return resp, err
+	}
+	if hint, ok := req.Context().Value(retryHintKey{}).(*RetryHint); ok {
+		hint.After = parseRetryAfter(resp.Header)
+	}
+	return resp, err
+}
+
+// parseRetryAfter reads OpenAI's retry-after-ms header or the standard Retry-After, given in
+// seconds or as an HTTP date. It returns 0 when neither is set.
+func parseRetryAfter(h http.Header) time.Duration {
+	if ms, err := strconv.ParseFloat(h.Get("Retry-After-Ms"), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+	raw := h.Get("Retry-After")
+	if secs, err := strconv.ParseFloat(raw, 64); err == nil && secs > 0 {
+		return time.Duration(secs * float64(time.Second))
+	}
+	if at, err := http.ParseTime(raw); err == nil {
+		if wait := time.Until(at); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
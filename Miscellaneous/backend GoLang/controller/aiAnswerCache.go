@@ -0,0 +1,251 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/portfolio-backend/config"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Semantic answer cache settings (env overridable)
+var (
+	answerCacheThreshold  = config.EnvFloat("AI_CACHE_THRESHOLD", 0.95)
+	answerCacheTTL        = config.EnvDuration("AI_CACHE_TTL", 24*time.Hour)
+	answerCacheMaxEntries = config.EnvInt("AI_CACHE_MAX_ENTRIES", 500)
+	answerCacheRefresh    = 5 * time.Minute
+)
+
+// answerCacheEntry is one cached answer, stored in the "answerCache" collection of the AI DB.
+type answerCacheEntry struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty"`
+	Query        string             `bson:"query"`
+	QueryKey     string             `bson:"queryKey"`
+	Embedding    []float32          `bson:"embedding"`
+	Answer       string             `bson:"answer"`
+	Sources      []string           `bson:"sources"`
+	IndexVersion string             `bson:"indexVersion"`     // answerCacheScope the answer was written under
+	Prompt       string             `bson:"prompt,omitempty"` // template version the answer was written with
+	Model        string             `bson:"model,omitempty"`
+	CreatedAt    time.Time          `bson:"createdAt"`
+	ExpiresAt    time.Time          `bson:"expiresAt"`
+	Hits         int                `bson:"hits"`
+
+	norm float64
+}
+
+// In-memory mirror of the cache for the current scope, refreshed from the DB periodically. The
+// lock only guards reading and swapping the fields; entries are never modified once added.
+var answerCache = struct {
+	sync.Mutex
+	entries    []*answerCacheEntry
+	scope      string
+	loadedAt   time.Time
+	refreshing bool   // a request is loading the entries
+	generation uint64 // bumped by purges, so a load started before one is discarded
+}{}
+
+// answerCacheLoadTimeout bounds one load of the cache entries.
+const answerCacheLoadTimeout = 5 * time.Second
+
+// answerCacheScope identifies what cached answers depend on besides the query: the memory index
+// version and the retrieval profile. Entries of another scope are never served. Persona, prompt
+// and model routing changes purge the cache instead.
+func answerCacheScope() string {
+	return currentIndex().Meta.Version + "|" + currentRetrievalProfile().Name
+}
+
+// answerCacheKey normalises a query for exact-match lookups.
+func answerCacheKey(query string) string {
+	return strings.Join(tokenize(query), " ")
+}
+
+// answerCacheEntries returns the live entries of the current scope, reloading them from the DB
+// when the mirror is stale. The DB is read without holding the lock; requests arriving meanwhile
+// use the entries already loaded for the scope, if any.
+func answerCacheEntries() []*answerCacheEntry {
+	scope := answerCacheScope()
+	answerCache.Lock()
+	fresh := answerCache.scope == scope && time.Since(answerCache.loadedAt) < answerCacheRefresh
+	if fresh || answerCache.refreshing {
+		defer answerCache.Unlock()
+		if answerCache.scope != scope {
+			return nil
+		}
+		return answerCache.entries
+	}
+	answerCache.refreshing = true
+	generation := answerCache.generation
+	answerCache.Unlock()
+
+	entries, err := loadAnswerCache(scope)
+
+	answerCache.Lock()
+	defer answerCache.Unlock()
+	answerCache.refreshing = false
+	if err != nil {
+		log.Println("Error loading answer cache:", err)
+	} else if answerCache.generation == generation {
+		answerCache.entries, answerCache.scope, answerCache.loadedAt = entries, scope, time.Now()
+	}
+	if answerCache.scope != scope {
+		return nil
+	}
+	return answerCache.entries
+}
+
+// loadAnswerCache reads the live entries of scope from the DB.
+func loadAnswerCache(scope string) ([]*answerCacheEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), answerCacheLoadTimeout)
+	defer cancel()
+	cur, err := config.GetDBAI().Collection("answerCache").Find(ctx, bson.M{
+		"indexVersion": scope,
+		"expiresAt":    bson.M{"$gt": time.Now()},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var entries []*answerCacheEntry
+	if err := cur.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		e.norm = vectorNorm(e.Embedding)
+	}
+	return entries, nil
+}
+
+// lookupAnswerCacheText returns a cached answer for an exact (normalised) repeat of query, so
+// the embedding call can be skipped too.
+func lookupAnswerCacheText(query string) *AskResult {
+	key := answerCacheKey(query)
+	now := time.Now()
+	for _, e := range answerCacheEntries() {
+		if e.QueryKey == key && now.Before(e.ExpiresAt) {
+			go recordAnswerCacheHit(e.ID)
+			return &AskResult{Answer: e.Answer, Sources: e.Sources, Cached: true, CacheSimilarity: 1, Prompt: e.Prompt, Model: e.Model}
+		}
+	}
+	return nil
+}
+
+// lookupAnswerCache returns the cached answer most similar to the query embedding when the
+// similarity clears the threshold and the entry was produced in the current scope.
+func lookupAnswerCache(qEmb []float32) *AskResult {
+	qNorm := vectorNorm(qEmb)
+	now := time.Now()
+	var best *answerCacheEntry
+	bestSim := answerCacheThreshold
+	for _, e := range answerCacheEntries() {
+		if !now.Before(e.ExpiresAt) || len(e.Embedding) != len(qEmb) || e.norm == 0 || qNorm == 0 {
+			continue
+		}
+		var dot float64
+		for i, x := range e.Embedding {
+			dot += float64(x) * float64(qEmb[i])
+		}
+		if sim := dot / (e.norm * qNorm); sim >= bestSim {
+			best, bestSim = e, sim
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	go recordAnswerCacheHit(best.ID)
+	return &AskResult{Answer: best.Answer, Sources: best.Sources, Cached: true, CacheSimilarity: bestSim, Prompt: best.Prompt, Model: best.Model}
+}
+
+// storeAnswerCache saves a freshly generated answer for future lookups.
+func storeAnswerCache(query string, qEmb []float32, result *AskResult) {
+	now := time.Now()
+	entry := &answerCacheEntry{
+		Query:        query,
+		QueryKey:     answerCacheKey(query),
+		Embedding:    qEmb,
+		Answer:       result.Answer,
+		Sources:      result.Sources,
+		IndexVersion: answerCacheScope(),
+		Prompt:       result.Prompt,
+		Model:        result.Model,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(answerCacheTTL),
+		norm:         vectorNorm(qEmb),
+	}
+	ctx := context.Background()
+	coll := config.GetDBAI().Collection("answerCache")
+	// Expired entries, and with them those of retired scopes, are dropped by a TTL index
+	ensureAnswerCacheIndex.Do(func() {
+		_, err := coll.CreateIndex(ctx, mongo.IndexModel{
+			Keys:    bson.M{"expiresAt": 1},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		})
+		if err != nil {
+			log.Println("Error creating answer cache expiry index:", err)
+		}
+	})
+	res, err := coll.InsertOne(ctx, entry)
+	if err != nil {
+		log.Println("Error saving answer cache entry:", err)
+		return
+	}
+	if id, ok := res.InsertedID.(primitive.ObjectID); ok {
+		entry.ID = id
+	}
+	answerCache.Lock()
+	if answerCache.scope == entry.IndexVersion {
+		answerCache.entries = append(answerCache.entries, entry)
+		// Keep the mirror bounded, oldest entries go first
+		if over := len(answerCache.entries) - answerCacheMaxEntries; over > 0 {
+			answerCache.entries = answerCache.entries[over:]
+		}
+	}
+	answerCache.Unlock()
+}
+
+// ensureAnswerCacheIndex creates the answer cache TTL index on the first store.
+var ensureAnswerCacheIndex sync.Once
+
+// recordAnswerCacheHit increments the hit counter of a cache entry.
+func recordAnswerCacheHit(id primitive.ObjectID) {
+	if id.IsZero() {
+		return
+	}
+	_, err := config.GetDBAI().Collection("answerCache").UpdateOne(context.Background(),
+		bson.M{"_id": id}, bson.M{"$inc": bson.M{"hits": 1}})
+	if err != nil {
+		log.Println("Error recording answer cache hit:", err)
+	}
+}
+
+// purgeAnswerCache empties the semantic answer cache and returns the number of deleted entries.
+func purgeAnswerCache(ctx context.Context) (int64, error) {
+	res, err := config.GetDBAI().Collection("answerCache").DeleteMany(ctx, bson.M{})
+	if err != nil {
+		return 0, err
+	}
+	answerCache.Lock()
+	answerCache.entries = nil
+	answerCache.loadedAt = time.Time{}
+	answerCache.generation++
+	answerCache.Unlock()
+	return res.DeletedCount, nil
+}
+
+// PurgeAnswerCache is the admin endpoint that empties the semantic answer cache.
+func PurgeAnswerCache(c *gin.Context) {
+	deleted, err := purgeAnswerCache(c.Request.Context())
+	if err != nil {
+		log.Println("Error purging answer cache:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error purging answer cache"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Answer cache purged.", "deleted": deleted})
+}
@@ -0,0 +1,467 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/portfolio-backend/config"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Over-budget modes
+const (
+	budgetModeReject  = "reject"  // AI endpoints answer 429 until the budget resets
+	budgetModeDegrade = "degrade" // questions get cached or extractive answers, other AI endpoints 429
+)
+
+// sessionHeader identifies a chat session for the per-session question quota. Requests without
+// it are only limited per IP.
+const sessionHeader = "X-Chat-Session"
+
+// budgetRefresh is how long the spend read from the usage aggregates is reused.
+var budgetRefresh = config.EnvDuration("AI_BUDGET_REFRESH", 30*time.Second)
+
+// BudgetPolicy caps the estimated AI spend and the questions a visitor may ask. Costs are in
+// USD, as estimated by the usage price table; a zero limit disables that check. It is stored
+// as a single document in the "aiBudget" collection of the AI DB. Admin requests are exempt.
+type BudgetPolicy struct {
+	Enabled               bool      `bson:"enabled" json:"enabled"`
+	DailyCost             float64   `bson:"dailyCost" json:"dailyCost"`
+	MonthlyCost           float64   `bson:"monthlyCost" json:"monthlyCost"`
+	IPDailyQuestions      int       `bson:"ipDailyQuestions" json:"ipDailyQuestions"`
+	SessionDailyQuestions int       `bson:"sessionDailyQuestions" json:"sessionDailyQuestions"`
+	Mode                  string    `bson:"mode" json:"mode"`                 // "reject" or "degrade" once a cost ceiling is hit
+	AlertWebhook          string    `bson:"alertWebhook" json:"alertWebhook"` // optional URL alerts are POSTed to as {"text": ...}
+	UpdatedAt             time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+// defaultBudgetPolicy returns the policy used until one is stored, configurable from the environment.
+func defaultBudgetPolicy() *BudgetPolicy {
+	return &BudgetPolicy{
+		Enabled:               config.EnvString("AI_BUDGET_ENABLED", "true") == "true",
+		DailyCost:             config.EnvFloat("AI_BUDGET_DAILY", 2),
+		MonthlyCost:           config.EnvFloat("AI_BUDGET_MONTHLY", 30),
+		IPDailyQuestions:      config.EnvInt("AI_QUOTA_IP_DAILY", 60),
+		SessionDailyQuestions: config.EnvInt("AI_QUOTA_SESSION_DAILY", 30),
+		Mode:                  config.EnvString("AI_BUDGET_MODE", budgetModeDegrade),
+		AlertWebhook:          config.EnvString("AI_ALERT_WEBHOOK", ""),
+	}
+}
+
+// Active budget policy
+var budgetPolicyState = struct {
+	sync.RWMutex
+	policy *BudgetPolicy
+}{}
+
+// currentBudgetPolicy returns the active budget policy.
+func currentBudgetPolicy() *BudgetPolicy {
+	budgetPolicyState.RLock()
+	defer budgetPolicyState.RUnlock()
+	if budgetPolicyState.policy == nil {
+		return defaultBudgetPolicy()
+	}
+	return budgetPolicyState.policy
+}
+
+// validate checks the budget policy.
+func (p *BudgetPolicy) validate() []string {
+	var errs []string
+	if p.DailyCost < 0 || p.MonthlyCost < 0 {
+		errs = append(errs, "cost limits must not be negative")
+	}
+	if p.IPDailyQuestions < 0 || p.SessionDailyQuestions < 0 {
+		errs = append(errs, "question quotas must not be negative")
+	}
+	if p.Mode != budgetModeReject && p.Mode != budgetModeDegrade {
+		errs = append(errs, "mode must be reject or degrade")
+	}
+	if p.AlertWebhook != "" && !strings.HasPrefix(p.AlertWebhook, "https://") && !strings.HasPrefix(p.AlertWebhook, "http://") {
+		errs = append(errs, "alertWebhook must be an http(s) URL")
+	}
+	return errs
+}
+
+// ensureQuotaIndex makes quota counters expire once their day is over.
+var ensureQuotaIndex sync.Once
+
+// reloadBudgetPolicy loads the stored budget policy, keeping the previous one if it is missing
+// or invalid.
+func reloadBudgetPolicy(ctx context.Context) {
+	ensureQuotaIndex.Do(func() {
+		_, err := config.GetDBAI().Collection("aiQuotas").CreateIndex(ctx, mongo.IndexModel{
+			Keys:    bson.M{"expiresAt": 1},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		})
+		if err != nil {
+			log.Println("Error creating quota expiry index:", err)
+		}
+	})
+	p := defaultBudgetPolicy()
+	err := config.GetDBAI().Collection("aiBudget").FindOne(ctx, bson.M{"_id": "budgetPolicy"}).Decode(p)
+	if err != nil {
+		return
+	}
+	if errs := p.validate(); len(errs) > 0 {
+		log.Printf("Invalid budget policy, keeping previous: %s", strings.Join(errs, "; "))
+		return
+	}
+	budgetPolicyState.Lock()
+	budgetPolicyState.policy = p
+	budgetPolicyState.Unlock()
+}
+
+// -- Spend and quotas --
+
+// budgetExceeded describes a tripped limit. It is kept in the request context of questions
+// answered in degrade mode.
+type budgetExceeded struct {
+	Limit   string // "daily-cost", "monthly-cost", "ip-quota" or "session-quota"
+	Message string
+	ResetAt time.Time
+}
+
+func (e *budgetExceeded) Error() string {
+	return e.Message
+}
+
+// budgetExceededKey is the context key of the tripped limit in degrade mode.
+type budgetExceededKey struct{}
+
+// overBudget returns the tripped limit when the request is answered in degrade mode.
+func overBudget(ctx context.Context) *budgetExceeded {
+	e, _ := ctx.Value(budgetExceededKey{}).(*budgetExceeded)
+	return e
+}
+
+// nextDay and nextMonth are when the daily and monthly counters reset (UTC).
+func nextDay(now time.Time) time.Time {
+	return now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+}
+
+func nextMonth(now time.Time) time.Time {
+	y, m, _ := now.UTC().Date()
+	return time.Date(y, m+1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// Spend of the current day and month, read from the daily usage aggregates shared by all replicas
+var spendState = struct {
+	sync.Mutex
+	daily, monthly float64
+	readAt         time.Time
+	refreshing     bool // a request is reading the aggregates
+}{}
+
+// spendReadTimeout bounds one read of the usage aggregates.
+const spendReadTimeout = 5 * time.Second
+
+// currentSpend returns today's and this month's estimated spend, refreshed every budgetRefresh.
+// The aggregates are read without holding the lock; requests arriving meanwhile get the previous
+// values.
+func currentSpend(ctx context.Context) (float64, float64, error) {
+	spendState.Lock()
+	if time.Since(spendState.readAt) < budgetRefresh || (spendState.refreshing && !spendState.readAt.IsZero()) {
+		defer spendState.Unlock()
+		return spendState.daily, spendState.monthly, nil
+	}
+	spendState.refreshing = true
+	spendState.Unlock()
+	defer func() {
+		spendState.Lock()
+		spendState.refreshing = false
+		spendState.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, spendReadTimeout)
+	defer cancel()
+	now := time.Now().UTC()
+	today := now.Truncate(24 * time.Hour)
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	cursor, err := config.GetDBAI().Collection("aiUsage").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"period": "day", "start": bson.M{"$gte": monthStart}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$start", "cost": bson.M{"$sum": "$cost"}}}},
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	var days []struct {
+		Start time.Time `bson:"_id"`
+		Cost  float64   `bson:"cost"`
+	}
+	if err := cursor.All(ctx, &days); err != nil {
+		return 0, 0, err
+	}
+	daily, monthly := 0.0, 0.0
+	for _, d := range days {
+		monthly += d.Cost
+		if d.Start.Equal(today) {
+			daily += d.Cost
+		}
+	}
+	spendState.Lock()
+	spendState.daily, spendState.monthly, spendState.readAt = daily, monthly, time.Now()
+	spendState.Unlock()
+	return daily, monthly, nil
+}
+
+// checkSpend returns the cost ceiling the spend has reached, if any.
+func checkSpend(ctx context.Context, p *BudgetPolicy) *budgetExceeded {
+	daily, monthly, err := currentSpend(ctx)
+	if err != nil {
+		// Fail open: a DB hiccup shouldn't take the chatbot down
+		log.Println("Error reading AI spend:", err)
+		return nil
+	}
+	now := time.Now()
+	if p.MonthlyCost > 0 && monthly >= p.MonthlyCost {
+		return &budgetExceeded{Limit: "monthly-cost", ResetAt: nextMonth(now),
+			Message: fmt.Sprintf("Monthly AI budget of $%.2f reached ($%.2f spent)", p.MonthlyCost, monthly)}
+	}
+	if p.DailyCost > 0 && daily >= p.DailyCost {
+		return &budgetExceeded{Limit: "daily-cost", ResetAt: nextDay(now),
+			Message: fmt.Sprintf("Daily AI budget of $%.2f reached ($%.2f spent)", p.DailyCost, daily)}
+	}
+	return nil
+}
+
+// countQuestion increments the visitor's question counter for today and returns it. Counters
+// live in the "aiQuotas" collection and expire after the day.
+func countQuestion(ctx context.Context, kind, id string) (int, error) {
+	now := time.Now()
+	var counter struct {
+		Count int `bson:"count"`
+	}
+	err := config.GetDBAI().Collection("aiQuotas").FindOneAndUpdate(ctx,
+		bson.M{"_id": kind + "|" + id + "|" + now.UTC().Format("2006-01-02")},
+		bson.M{"$inc": bson.M{"count": 1}, "$setOnInsert": bson.M{"kind": kind, "expiresAt": nextDay(now)}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&counter)
+	return counter.Count, err
+}
+
+// checkQuotas counts the question against the visitor's IP and session quotas and returns the
+// quota it exceeds, if any.
+func checkQuotas(ctx context.Context, p *BudgetPolicy, c *gin.Context) *budgetExceeded {
+	type quota struct {
+		kind, id string
+		limit    int
+	}
+	quotas := []quota{{"ip", c.ClientIP(), p.IPDailyQuestions}}
+	if session := c.GetHeader(sessionHeader); session != "" && len(session) <= 100 {
+		quotas = append(quotas, quota{"session", session, p.SessionDailyQuestions})
+	}
+	for _, q := range quotas {
+		if q.limit <= 0 {
+			continue
+		}
+		count, err := countQuestion(ctx, q.kind, q.id)
+		if err != nil {
+			log.Printf("Error counting %s question quota: %v", q.kind, err)
+			continue
+		}
+		if count > q.limit {
+			return &budgetExceeded{Limit: q.kind + "-quota", ResetAt: nextDay(time.Now()),
+				Message: fmt.Sprintf("Daily limit of %d questions per %s reached", q.limit, q.kind)}
+		}
+	}
+	return nil
+}
+
+// BudgetGuard enforces the budget policy on AI endpoints that call the provider. Questions
+// (question=true) also count against the visitor quotas; in degrade mode they are still
+// answered over budget, from the cache or extractively, while other endpoints answer 429.
+func BudgetGuard(question bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p := currentBudgetPolicy()
+		if !p.Enabled || isAdminRequest(c) {
+			c.Next()
+			return
+		}
+		ctx := c.Request.Context()
+		if question {
+			if e := checkQuotas(ctx, p, c); e != nil {
+				raiseBudgetAlert(p, e, c.ClientIP())
+				rejectOverBudget(c, e)
+				return
+			}
+		}
+		e := checkSpend(ctx, p)
+		if e == nil {
+			c.Next()
+			return
+		}
+		raiseBudgetAlert(p, e, "")
+		if question && p.Mode == budgetModeDegrade {
+			c.Request = c.Request.WithContext(context.WithValue(ctx, budgetExceededKey{}, e))
+			c.Next()
+			return
+		}
+		rejectOverBudget(c, e)
+	}
+}
+
+// rejectOverBudget answers 429 with the time the limit resets.
+func rejectOverBudget(c *gin.Context, e *budgetExceeded) {
+	c.Header("Retry-After", strconv.Itoa(int(time.Until(e.ResetAt).Round(time.Second).Seconds())))
+	message := "The AI assistant has reached its usage limit for now. Please try again later."
+	if strings.HasSuffix(e.Limit, "-quota") {
+		message = "You've reached the daily question limit. Please come back tomorrow."
+	}
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+		"message": message,
+		"limit":   e.Limit,
+		"resetAt": e.ResetAt,
+	})
+}
+
+// -- Alerts --
+
+// raisedAlerts holds the alerts this replica already raised, sparing the DB a write per request,
+// with the time their limit resets. Entries are pruned once reset, as quota alerts add one per
+// visitor and day.
+var raisedAlerts = struct {
+	sync.Mutex
+	resets   map[string]time.Time
+	prunedAt time.Time
+}{resets: map[string]time.Time{}}
+
+// alertPruneInterval is how often reset entries are dropped from raisedAlerts.
+const alertPruneInterval = time.Hour
+
+// markAlertRaised records the alert and reports whether this replica had already raised it.
+func markAlertRaised(id string, resetAt time.Time) bool {
+	now := time.Now()
+	raisedAlerts.Lock()
+	defer raisedAlerts.Unlock()
+	if now.Sub(raisedAlerts.prunedAt) >= alertPruneInterval {
+		for key, reset := range raisedAlerts.resets {
+			if !now.Before(reset) {
+				delete(raisedAlerts.resets, key)
+			}
+		}
+		raisedAlerts.prunedAt = now
+	}
+	if _, raised := raisedAlerts.resets[id]; raised {
+		return true
+	}
+	raisedAlerts.resets[id] = resetAt
+	return false
+}
+
+// raiseBudgetAlert records a tripped limit in the "aiAlerts" collection and POSTs it to the
+// alert webhook. Each limit alerts once per period (and quotas once per visitor), across replicas.
+func raiseBudgetAlert(p *BudgetPolicy, e *budgetExceeded, visitor string) {
+	id := e.Limit + "|" + e.ResetAt.Format(time.RFC3339)
+	if visitor != "" {
+		id += "|" + visitor
+	}
+	if markAlertRaised(id, e.ResetAt) {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		res, err := config.GetDBAI().Collection("aiAlerts").UpdateOne(ctx,
+			bson.M{"_id": id},
+			bson.M{"$setOnInsert": bson.M{"limit": e.Limit, "message": e.Message, "visitor": visitor, "resetAt": e.ResetAt, "createdAt": time.Now()}},
+			optionsUpsert(),
+		)
+		if err != nil {
+			log.Println("Error saving budget alert:", err)
+			return
+		}
+		if res.UpsertedCount == 0 {
+			return
+		}
+		log.Printf("💸 AI budget alert: %s (resets %s)", e.Message, e.ResetAt.Format(time.RFC1123))
+		if p.AlertWebhook == "" {
+			return
+		}
+		text := fmt.Sprintf("AI budget alert: %s. Resets %s.", e.Message, e.ResetAt.Format(time.RFC1123))
+		if visitor != "" {
+			text += " Visitor: " + visitor
+		}
+		body, _ := json.Marshal(gin.H{"text": text})
+		resp, err := (&http.Client{Timeout: 5 * time.Second}).Post(p.AlertWebhook, "application/json", bytes.NewReader(body))
+		if err != nil {
+			log.Println("Error sending budget alert:", err)
+			return
+		}
+		resp.Body.Close()
+	}()
+}
+
+// -- Admin handlers --
+
+// GetBudget returns the budget policy, the current spend against it and the latest alerts.
+func GetBudget(c *gin.Context) {
+	ctx := c.Request.Context()
+	daily, monthly, err := currentSpend(ctx)
+	if err != nil {
+		log.Println("Error reading AI spend:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error reading AI spend"})
+		return
+	}
+	cursor, err := config.GetDBAI().Collection("aiAlerts").Find(ctx, bson.M{},
+		options.Find().SetSort(bson.M{"createdAt": -1}).SetLimit(20))
+	if err != nil {
+		log.Println("Error loading budget alerts:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error loading budget alerts"})
+		return
+	}
+	alerts := []bson.M{}
+	if err := cursor.All(ctx, &alerts); err != nil {
+		log.Println("Error decoding budget alerts:", err)
+	}
+	now := time.Now()
+	c.JSON(http.StatusOK, gin.H{
+		"policy": currentBudgetPolicy(),
+		"spend": gin.H{
+			"daily":          daily,
+			"monthly":        monthly,
+			"dailyResetAt":   nextDay(now),
+			"monthlyResetAt": nextMonth(now),
+		},
+		"alerts": alerts,
+	})
+}
+
+// PutBudget validates, stores and activates a budget policy.
+func PutBudget(c *gin.Context) {
+	ctx := c.Request.Context()
+	p := defaultBudgetPolicy()
+	if err := c.BindJSON(p); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid budget policy data"})
+		return
+	}
+	if errs := p.validate(); len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid budget policy", "errors": errs})
+		return
+	}
+	p.UpdatedAt = time.Now()
+	_, err := config.GetDBAI().Collection("aiBudget").UpdateOne(ctx,
+		bson.M{"_id": "budgetPolicy"},
+		bson.M{"$set": p},
+		optionsUpsert(),
+	)
+	if err != nil {
+		log.Println("Error saving budget policy:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving budget policy"})
+		return
+	}
+	budgetPolicyState.Lock()
+	budgetPolicyState.policy = p
+	budgetPolicyState.Unlock()
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Budget policy saved.", "policy": p})
+}
@@ -3,8 +3,10 @@ package controllers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"regexp"
 	"sort"
 	"strings"
@@ -13,62 +15,106 @@ import (
 
 	"example.com/portfolio-backend/config"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
-// Category weighting and boosting factors
+// Default category weighting and boosting factors (overridable at runtime via retrieval profiles)
 var categoryWeights = map[string]float64{"db": 0.7, "resume": 0.3, "github": 0.1}
 var queryBoost = map[string]float64{"db": 0.1, "resume": 0.1, "github": 0.1}
-var dbTerms = []string{"experience", "project", "honors", "skills", "involvement", "yearinreview"}
 var resumeTerms = []string{"education", "experience", "skills", "projects", "honors", "involvement", "year in review"}
 
-// In-memory caches for context snapshots
-var contextMeta = struct {
-	DbContextLastUpdate      string `bson:"dbContextLastUpdate,omitempty"`
-	GithubContextLastUpdate  string `bson:"githubContextLastUpdate,omitempty"`
-	ResumeContextLastUpdate  string `bson:"resumeContextLastUpdate,omitempty"`
-}{}
-var memoryIndexMeta = struct {
-	LastUpdate string `bson:"lastUpdate,omitempty"`
-}{}
+// contextMetaDoc holds the last update time of each context snapshot.
+type contextMetaDoc struct {
+	DbContextLastUpdate     string `bson:"dbContextLastUpdate,omitempty"`
+	GithubContextLastUpdate string `bson:"githubContextLastUpdate,omitempty"`
+	ResumeContextLastUpdate string `bson:"resumeContextLastUpdate,omitempty"`
+}
+
+// In-memory caches for context snapshots. contextMetaMu guards contextMeta: the background init
+// and the daily refreshes write it while readiness probes read it.
+var (
+	contextMeta   contextMetaDoc
+	contextMetaMu sync.RWMutex
+)
+
+// currentContextMeta returns a copy of contextMeta.
+func currentContextMeta() contextMetaDoc {
+	contextMetaMu.RLock()
+	defer contextMetaMu.RUnlock()
+	return contextMeta
+}
+
+// indexMeta describes the active memory index version; it is stored as the "memoryIndexMeta" document.
+type indexMeta struct {
+	LastUpdate    string         `bson:"lastUpdate,omitempty"`
+	Version       string         `bson:"version,omitempty"`    // active index version, see IndexVersion
+	Embedder      string         `bson:"embedder,omitempty"`   // name of the embedder that produced the vectors
+	Dimensions    int            `bson:"dimensions,omitempty"` // vector size
+	EmbedderState *EmbedderState `bson:"embedderState,omitempty"`
+}
+
+// legacyEmbedder is assumed for indexes saved before the embedder was recorded.
+const legacyEmbedder = "openai"
 
 // MemoryIndex and context data
 type MemoryItem struct {
-	Category string
-	Text     string
-	Embedding []float32
-	Norm     float64
+	Category  string
+	Source    string // stable document id, e.g. "db/projectTable/FinVest"
+	Text      string
+	Vector    QuantizedVector // int8 vector used for scoring
+	Embedding []float32       // exact vector, only kept for rescoring (AI_VECTOR_RESCORE_TOP)
+	Norm      float64
 }
-var memoryIndex []MemoryItem
 
 // Initialize AI context: load context meta, ensure snapshots are up to date, build memory index.
 func InitContext() error {
 	ctx := context.Background()
 	// Load context metadata (timestamps)
 	loadContextMeta(ctx)
-	loadMemoryIndexMeta(ctx)
+	reloadRetrievalProfile(ctx)
+	reloadPersona(ctx)
+	reloadPromptTemplates(ctx)
+	reloadModelRouting(ctx)
+	reloadGuardrailPolicy(ctx)
+	reloadRedactionPolicy(ctx)
+	reloadPriceTable(ctx)
+	reloadBudgetPolicy(ctx)
 	today := time.Now().UTC().Truncate(24 * time.Hour)
-	// If any context snapshot is missing or not updated today, update it
-	if contextMeta.DbContextLastUpdate == "" || parseTime(contextMeta.DbContextLastUpdate).Before(today) {
-		if err := updateDbContextFile(ctx); err != nil {
-			return fmt.Errorf("failed to update DB context: %w", err)
+	// If any context snapshot is missing or not updated today, update it. A failed refresh only
+	// blocks startup when there is no earlier snapshot to fall back on.
+	refresh := func(name, lastUpdate string, update func(context.Context) error) error {
+		if lastUpdate != "" && !parseTime(lastUpdate).Before(today) {
+			return nil
 		}
-	}
-	if contextMeta.GithubContextLastUpdate == "" || parseTime(contextMeta.GithubContextLastUpdate).Before(today) {
-		if err := updateGithubContextFile(ctx); err != nil {
-			return fmt.Errorf("failed to update GitHub context: %w", err)
+		setInitPhase("refreshing " + name + " context")
+		err := update(ctx)
+		recordSnapshotRefresh(name, err)
+		if err != nil && lastUpdate == "" {
+			return fmt.Errorf("failed to update %s context: %w", name, err)
 		}
-	}
-	if contextMeta.ResumeContextLastUpdate == "" || parseTime(contextMeta.ResumeContextLastUpdate).Before(today) {
-		if err := updateResumeContextFile(ctx); err != nil {
-			return fmt.Errorf("failed to update Resume context: %w", err)
+		if err != nil {
+			log.Printf("⚠️ %s context refresh failed, keeping snapshot from %s: %v", name, lastUpdate, err)
 		}
+		return nil
+	}
+	meta := currentContextMeta()
+	if err := refresh("DB", meta.DbContextLastUpdate, updateDbContextFile); err != nil {
+		return err
+	}
+	if err := refresh("GitHub", meta.GithubContextLastUpdate, updateGithubContextFile); err != nil {
+		return err
+	}
+	if err := refresh("Resume", meta.ResumeContextLastUpdate, updateResumeContextFile); err != nil {
+		return err
 	}
 	// Build memory index (do not force rebuild unless needed)
+	setInitPhase("building memory index")
 	if err := buildMemoryIndex(ctx, false); err != nil {
 		return fmt.Errorf("failed to build memory index: %w", err)
 	}
 	// Schedule daily context updates and weekly memory index rebuild:
 	go scheduleDailyTasks()
+	watchRetrievalProfiles()
 	return nil
 }
 
@@ -87,9 +133,11 @@ func loadContextMeta(ctx context.Context) {
 	}
 	_ = db.Collection("contextMeta").FindOne(ctx, bson.M{"_id": "contextMeta"}).Decode(&doc)
 	if doc.DbContextLastUpdate != "" || doc.GithubContextLastUpdate != "" || doc.ResumeContextLastUpdate != "" {
+		contextMetaMu.Lock()
 		contextMeta.DbContextLastUpdate = doc.DbContextLastUpdate
 		contextMeta.GithubContextLastUpdate = doc.GithubContextLastUpdate
 		contextMeta.ResumeContextLastUpdate = doc.ResumeContextLastUpdate
+		contextMetaMu.Unlock()
 	}
 }
 
@@ -98,7 +146,7 @@ func saveContextMeta(ctx context.Context) {
 	db := config.GetDBAI()
 	_, err := db.Collection("contextMeta").UpdateOne(ctx,
 		bson.M{"_id": "contextMeta"},
-		bson.M{"$set": contextMeta},
+		bson.M{"$set": currentContextMeta()},
 		optionsUpsert(),
 	)
 	if err != nil {
@@ -106,20 +154,31 @@ func saveContextMeta(ctx context.Context) {
 	}
 }
 
-// loadMemoryIndexMeta loads memoryIndexMeta document from DB.
-func loadMemoryIndexMeta(ctx context.Context) {
-	db := config.GetDBAI()
-	var doc struct{ LastUpdate string `bson:"lastUpdate"` }
-	_ = db.Collection("memoryIndexMeta").FindOne(ctx, bson.M{"_id": "memoryIndexMeta"}).Decode(&doc)
-	memoryIndexMeta.LastUpdate = doc.LastUpdate
+// loadMemoryIndexMeta loads the memoryIndexMeta document from DB; it is empty before the first build.
+func loadMemoryIndexMeta(ctx context.Context) (indexMeta, error) {
+	var meta indexMeta
+	err := config.GetDBAI().Collection("memoryIndexMeta").FindOne(ctx, bson.M{"_id": "memoryIndexMeta"}).Decode(&meta)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return meta, err
+	}
+	if meta.LastUpdate != "" && meta.Embedder == "" {
+		meta.Embedder = legacyEmbedder
+	}
+	return meta, nil
 }
 
 // saveMemoryIndexMeta persists the memoryIndexMeta to DB.
-func saveMemoryIndexMeta(ctx context.Context) {
+func saveMemoryIndexMeta(ctx context.Context, meta indexMeta) {
 	db := config.GetDBAI()
 	_, err := db.Collection("memoryIndexMeta").UpdateOne(ctx,
 		bson.M{"_id": "memoryIndexMeta"},
-		bson.M{"$set": bson.M{"lastUpdate": memoryIndexMeta.LastUpdate}},
+		bson.M{"$set": bson.M{
+			"lastUpdate":    meta.LastUpdate,
+			"version":       meta.Version,
+			"embedder":      meta.Embedder,
+			"dimensions":    meta.Dimensions,
+			"embedderState": meta.EmbedderState,
+		}},
 		optionsUpsert(),
 	)
 	if err != nil {
@@ -168,20 +227,25 @@ func updateDbContextFile(ctx context.Context) error {
 	if cleaned == nil {
 		cleaned = map[string]interface{}{} // ensure not nil
 	}
+	// Drop denied fields and scrub PII/secrets before anything is embedded
+	redaction := newRedactionReport()
+	cleaned = currentRedactionPolicy().redactValue(cleaned, redaction)
 	// Upsert snapshot into dbContexts collection
 	dbAI := config.GetDBAI()
 	_, err := dbAI.Collection("dbContexts").UpdateOne(ctx,
 		bson.M{"_id": "current"},
-		bson.M{"$set": bson.M{"data": cleaned, "createdAt": time.Now()}},
+		bson.M{"$set": bson.M{"data": cleaned, "createdAt": time.Now(), "redaction": redaction}},
 		optionsUpsert(),
 	)
 	if err != nil {
 		return err
 	}
 	// Update contextMeta timestamp
+	contextMetaMu.Lock()
 	contextMeta.DbContextLastUpdate = time.Now().Format(time.RFC3339)
+	contextMetaMu.Unlock()
 	saveContextMeta(ctx)
-	log.Printf("✅ dbContexts snapshot saved (%d tables)", len(aggregated))
+	log.Printf("✅ dbContexts snapshot saved (%d tables, %d redactions)", len(aggregated), redaction.Total)
 	return nil
 }
 
@@ -193,6 +257,8 @@ func updateGithubContextFile(ctx context.Context) error {
 		return err
 	}
 	out := make([]map[string]interface{}, 0, len(repos))
+	policy := currentRedactionPolicy()
+	redaction := newRedactionReport()
 	for _, r := range repos {
 		info := map[string]interface{}{
 			"name":        r.Name,
@@ -218,8 +284,8 @@ func updateGithubContextFile(ctx context.Context) error {
 		} else if err != nil && err.Error() != "404" {
 			log.Printf("README error %s: %v", r.FullName, err)
 		}
-		// Remove empty fields from info
-		cleaned := removeEmptyFields(info)
+		// Remove empty fields from info, then scrub PII/secrets (READMEs often carry them)
+		cleaned := policy.redactValue(removeEmptyFields(info), redaction)
 		if cleaned != nil {
 			out = append(out, cleaned.(map[string]interface{}))
 		} else {
@@ -230,34 +296,40 @@ func updateGithubContextFile(ctx context.Context) error {
 	dbAI := config.GetDBAI()
 	_, err := dbAI.Collection("githubContexts").UpdateOne(ctx,
 		bson.M{"_id": "current"},
-		bson.M{"$set": bson.M{"data": out, "createdAt": time.Now()}},
+		bson.M{"$set": bson.M{"data": out, "createdAt": time.Now(), "redaction": redaction}},
 		optionsUpsert(),
 	)
 	if err != nil {
 		return err
 	}
+	contextMetaMu.Lock()
 	contextMeta.GithubContextLastUpdate = time.Now().Format(time.RFC3339)
+	contextMetaMu.Unlock()
 	saveContextMeta(ctx)
-	log.Printf("✅ githubContexts snapshot saved (%d repos)", len(out))
+	log.Printf("✅ githubContexts snapshot saved (%d repos, %d redactions)", len(out), redaction.Total)
 	return nil
 }
 
 // updateResumeContextFile parses the resume PDF text and stores snapshot in AI DB.
 func updateResumeContextFile(ctx context.Context) error {
 	resumeText := parseResumePDF()  // (Assume we have a function to read "data/Singh_Kartavya_Resume2025.pdf" and return its text)
-	snapshot := map[string]string{"resume_text": strings.TrimSpace(resumeText)}
+	redaction := newRedactionReport()
+	resumeText = currentRedactionPolicy().redactText(strings.TrimSpace(resumeText), redaction)
+	snapshot := map[string]string{"resume_text": resumeText}
 	dbAI := config.GetDBAI()
 	_, err := dbAI.Collection("resumeContexts").UpdateOne(ctx,
 		bson.M{"_id": "current"},
-		bson.M{"$set": bson.M{"data": snapshot, "createdAt": time.Now()}},
+		bson.M{"$set": bson.M{"data": snapshot, "createdAt": time.Now(), "redaction": redaction}},
 		optionsUpsert(),
 	)
 	if err != nil {
 		return err
 	}
+	contextMetaMu.Lock()
 	contextMeta.ResumeContextLastUpdate = time.Now().Format(time.RFC3339)
+	contextMetaMu.Unlock()
 	saveContextMeta(ctx)
-	log.Printf("✅ resumeContexts snapshot saved (%d chars)", len(snapshot["resume_text"]))
+	log.Printf("✅ resumeContexts snapshot saved (%d chars, %d redactions)", len(snapshot["resume_text"]), redaction.Total)
 	return nil
 }
 
@@ -320,6 +392,11 @@ func loadAndChunkData(ctx context.Context) ([]MemoryItem, error) {
 	if err != nil {
 		return nil, err
 	}
+	return chunkContextSnapshots(dbJSON, ghJSON, resJSON), nil
+}
+
+// chunkContextSnapshots parses the DB, GitHub and Resume snapshot JSON and splits them into chunks.
+func chunkContextSnapshots(dbJSON, ghJSON, resJSON string) []MemoryItem {
 	var dbData map[string]interface{}
 	var ghData []interface{}
 	var resData map[string]string
@@ -334,12 +411,14 @@ func loadAndChunkData(ctx context.Context) ([]MemoryItem, error) {
 	if resText, ok := resData["resume_text"]; ok {
 		chunks = append(chunks, chunkResumeContext(resText)...)
 	}
-	return chunks, nil
+	redactChunks(chunks)
+	return chunks
 }
 
 // chunkDbContext converts aggregated DB context data into labeled text chunks.
 func chunkDbContext(dbData map[string]interface{}) []MemoryItem {
 	var chunks []MemoryItem
+	policy := currentRedactionPolicy()
 	// Mapping table names to pretty labels
 	tableLabels := map[string]string{
 		"experienceTable":       "Experience",
@@ -363,9 +442,21 @@ func chunkDbContext(dbData map[string]interface{}) []MemoryItem {
 					var titleVal string
 					var shortFields []string
 					var longText string
-					for k, val := range m {
+					// Walk keys in a stable order so the chunk text and Source id are deterministic
+					keys := make([]string, 0, len(m))
+					for k := range m {
+						keys = append(keys, k)
+					}
+					sort.Strings(keys)
+					for _, k := range keys {
+						if policy.deniesField(k) {
+							// skip sensitive
+							continue
+						}
+						val := m[k]
 						strVal := fmt.Sprintf("%v", val)
-						if strings.HasSuffix(strings.ToLower(k), "title") || strings.HasSuffix(strings.ToLower(k), "name") {
+						lk := strings.ToLower(k)
+						if (strings.HasSuffix(lk, "title") && !strings.HasSuffix(lk, "subtitle")) || strings.HasSuffix(lk, "name") {
 							titleVal = strVal
 						} else if len(strVal) > 100 || strings.Contains(strVal, "\n") || strings.Contains(strings.ToLower(k), "description") {
 							// treat as long text
@@ -376,10 +467,6 @@ func chunkDbContext(dbData map[string]interface{}) []MemoryItem {
 						} else {
 							// short field (like date, location, etc.)
 							if strVal != "" {
-								if strings.Contains(strings.ToLower(k), "password") {
-									// skip sensitive
-									continue
-								}
 								shortFields = append(shortFields, fmt.Sprintf("%s: %s", k, strVal))
 							}
 						}
@@ -395,7 +482,7 @@ func chunkDbContext(dbData map[string]interface{}) []MemoryItem {
 						lt := strings.TrimSpace(longText)
 						text += "\n" + lt
 					}
-					chunks = append(chunks, MemoryItem{Category: "db", Text: text})
+					chunks = append(chunks, MemoryItem{Category: "db", Source: "db/" + table + "/" + titleVal, Text: text})
 				}
 			}
 		}
@@ -426,7 +513,7 @@ func chunkGithubContext(ghData []interface{}) []MemoryItem {
 			if readme != "" && readme != "<nil>" {
 				line += "\nREADME: " + readme
 			}
-			chunks = append(chunks, MemoryItem{Category: "github", Text: strings.TrimSpace(line)})
+			chunks = append(chunks, MemoryItem{Category: "github", Source: "github/" + name, Text: strings.TrimSpace(line)})
 		}
 	}
 	return chunks
@@ -445,7 +532,7 @@ func chunkResumeContext(resumeText string) []MemoryItem {
 	indices := re.FindAllStringIndex(resumeText, -1)
 	if len(indices) <= 1 {
 		// No multiple sections found, treat entire resume as one chunk
-		chunks = append(chunks, MemoryItem{Category: "resume", Text: resumeText})
+		chunks = append(chunks, MemoryItem{Category: "resume", Source: "resume/full", Text: resumeText})
 	} else {
 		// Multiple sections: split at those headings
 		for i := 0; i < len(indices); i++ {
@@ -458,63 +545,81 @@ func chunkResumeContext(resumeText string) []MemoryItem {
 			}
 			sectionText := strings.TrimSpace(resumeText[startIdx:endIdx])
 			if sectionText != "" {
-				chunks = append(chunks, MemoryItem{Category: "resume", Text: sectionText})
+				heading := strings.ToLower(strings.ReplaceAll(resumeText[indices[i][0]:indices[i][1]], " ", ""))
+				chunks = append(chunks, MemoryItem{Category: "resume", Source: "resume/" + heading, Text: sectionText})
 			}
 		}
 	}
 	return chunks
 }
 
-// buildMemoryIndex builds (or loads) the memory index of embedded chunks for retrieval.
+// indexBuild serializes memory index builds. Startup, ensureMemoryIndex and a background
+// migration may all build at once, and each activation would otherwise drop the chunks of a
+// version another build was about to activate.
+var indexBuild sync.Mutex
+
+// buildMemoryIndex builds (or loads) the memory index of embedded chunks for retrieval and
+// publishes it. The stored meta is read afresh, so a version activated by another build is
+// loaded rather than rebuilt.
 func buildMemoryIndex(ctx context.Context, forceRebuild bool) error {
+	indexBuild.Lock()
+	defer indexBuild.Unlock()
+	meta, err := loadMemoryIndexMeta(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load memory index meta: %w", err)
+	}
 	now := time.Now()
 	currentMonth := now.Year()*12 + int(now.Month())
 	lastUpdateMonth := -1
-	if memoryIndexMeta.LastUpdate != "" {
-		t := parseTime(memoryIndexMeta.LastUpdate)
+	if meta.LastUpdate != "" {
+		t := parseTime(meta.LastUpdate)
 		lastUpdateMonth = t.Year()*12 + int(t.Month())
 	}
 	dbAI := config.GetDBAI()
-	// Count current memoryIndex docs in DB
-	count, _ := dbAI.Collection("memoryIndex").CountDocuments(ctx, bson.M{})
-	if !forceRebuild && lastUpdateMonth == currentMonth && count > 0 {
-		// Load memoryIndex from DB
-		cur, err := dbAI.Collection("memoryIndex").Find(ctx, bson.M{})
+	// Count current memoryIndex docs of the active version in DB
+	count, _ := dbAI.Collection("memoryIndex").CountDocuments(ctx, indexVersionFilter(meta.Version))
+	// Vectors from another embedder can't be compared with its query vectors: keep serving the
+	// stored version with the embedder that produced it and re-embed in the background
+	embedder := configuredEmbedder()
+	served := embedder
+	if !forceRebuild && count > 0 && meta.Embedder != embedder.Name() {
+		previous, err := embedderByName(meta.Embedder, meta.EmbedderState)
 		if err != nil {
-			return err
+			log.Printf("Memory index version %q can't be queried (%v); rebuilding with %q", meta.Version, err, embedder.Name())
+			forceRebuild = true
+		} else {
+			log.Printf("Memory index version %q was embedded with %q (%d dims), configured embedder is %q",
+				meta.Version, meta.Embedder, meta.Dimensions, embedder.Name())
+			served = previous
 		}
-		var docs []struct {
-			Category  string             `bson:"category"`
-			Text      string             `bson:"text"`
-			Embedding primitive.A        `bson:"embedding"`
+	} else if ce, ok := embedder.(corpusEmbedder); ok && !forceRebuild && count > 0 {
+		if err := ce.Restore(meta.EmbedderState); err != nil {
+			log.Printf("Memory index embedder state unusable (%v); rebuilding", err)
+			forceRebuild = true
 		}
-		if err = cur.All(ctx, &docs); err != nil {
+	}
+	if !forceRebuild && lastUpdateMonth == currentMonth && count > 0 {
+		// Load from the local snapshot when it matches the active version, otherwise from DB
+		if snap := loadIndexSnapshot(meta, count); snap != nil {
+			publishIndex(snap.Items, meta, served)
+			snap.restoreLexicalIndex()
+			log.Printf("Memory index up-to-date (%d items, version %q), loaded from snapshot", len(snap.Items), meta.Version)
+			if served.Name() != embedder.Name() {
+				startIndexMigration()
+			}
+			return nil
+		}
+		loaded, err := loadStoredIndex(ctx, meta.Version)
+		if err != nil {
 			return err
 		}
-		memoryIndex = memoryIndex[:0]
-		for _, doc := range docs {
-			// Convert primitive.A (array of float64) to []float32
-			vec := make([]float32, len(doc.Embedding))
-			for i, v := range doc.Embedding {
-				// Assuming all elements are float64
-				if f, ok := v.(float64); ok {
-					vec[i] = float32(f)
-				}
-			}
-			// Compute norm
-			var sum float64
-			for _, x := range vec {
-				sum += float64(x * x)
-			}
-			norm := 0.0
-			if sum > 0 {
-				norm = float64(fmt.Sprintf("%.6f", sum)) // just to restrict precision
-				norm = sum // fix: actual sqrt for norm
-			}
-			norm = sqrt(sum) // conceptually
-			memoryIndex = append(memoryIndex, MemoryItem{Category: doc.Category, Text: doc.Text, Embedding: vec, Norm: norm})
+		publishIndex(loaded, meta, served)
+		ensureVectorSearchIndex(ctx, meta.Dimensions)
+		saveIndexSnapshot(currentIndex())
+		log.Printf("Memory index up-to-date (%d items, version %q), loaded from DB", len(loaded), meta.Version)
+		if served.Name() != embedder.Name() {
+			startIndexMigration()
 		}
-		log.Printf("Memory index up-to-date (%d items), loaded from DB", len(memoryIndex))
 		return nil
 	}
 	log.Println("🔄 Rebuilding memory index...")
@@ -523,6 +628,20 @@ func buildMemoryIndex(ctx context.Context, forceRebuild bool) error {
 	if err != nil {
 		return fmt.Errorf("error loading context data for embedding: %w", err)
 	}
+	version := &IndexVersion{Version: newIndexVersion(now), Embedder: embedder.Name(), Status: indexVersionBuilding, CreatedAt: now}
+	saveIndexVersion(ctx, version)
+	// Fit a copy so queries against the served version keep their vectors until the swap
+	builder := embedder
+	if ce, ok := embedder.(corpusEmbedder); ok {
+		builder = ce.Unfitted()
+	}
+	fitEmbedder(builder, chunks)
+	failVersion := func(err error) error {
+		version.Status, version.Error = indexVersionFailed, err.Error()
+		saveIndexVersion(ctx, version)
+		dbAI.Collection("memoryIndex").DeleteMany(ctx, bson.M{"version": version.Version})
+		return err
+	}
 	var outDocs []interface{}
 	var newMemory []MemoryItem
 	for _, chunk := range chunks {
@@ -531,49 +650,139 @@ func buildMemoryIndex(ctx context.Context, forceRebuild bool) error {
 		if strings.TrimSpace(text) == "" {
 			continue
 		}
-		emb, err := getEmbedding(text)
+		emb, err := builder.Embed(ctx, text)
 		if err != nil {
+			// A build missing chunks to an unhealthy provider is failed rather than served;
+			// only chunks the provider rejects outright are skipped
+			if retryable(ctx, err) || errors.Is(err, errCircuitOpen) {
+				return failVersion(fmt.Errorf("embedding %s chunk: %w", chunk.Source, err))
+			}
 			log.Println("Embed error:", err)
 			continue
 		}
-		// Compute vector norm
-		var sum float64
-		for _, x := range emb {
-			sum += float64(x) * float64(x)
-		}
-		norm := 0.0
-		if sum > 0 {
-			norm = float64(sum) // actual sqrt omitted for brevity
-			norm = sum // fix: actual sqrt for norm
-		}
-		norm = sqrt(sum)
-		// Prepare document for DB
-		outDocs = append(outDocs, bson.M{
+		// Prepare document for DB, with the vectors as BinData
+		doc := bson.M{
+			"version":   version.Version,
 			"category":  chunk.Category,
+			"source":    chunk.Source,
 			"text":      chunk.Text,
-			"embedding": emb,
 			"createdAt": now,
-		})
+		}
+		for k, v := range vectorFields(emb, storeExactVectors()) {
+			doc[k] = v
+		}
+		outDocs = append(outDocs, doc)
 		// Prepare in-memory item
-		newMemory = append(newMemory, MemoryItem{Category: chunk.Category, Text: chunk.Text, Embedding: emb, Norm: norm})
-	}
-	// Replace memoryIndex in DB
-	dbAI.Collection("memoryIndex").DeleteMany(ctx, bson.M{})
-	if len(outDocs) > 0 {
-		_, err := dbAI.Collection("memoryIndex").InsertMany(ctx, outDocs)
-		if err != nil {
-			return fmt.Errorf("failed to insert memoryIndex docs: %w", err)
+		item := MemoryItem{Category: chunk.Category, Source: chunk.Source, Text: chunk.Text}
+		item.setEmbedding(emb)
+		newMemory = append(newMemory, item)
+	}
+	// Store the new version next to the served one; an empty build never replaces it
+	if len(outDocs) == 0 {
+		return failVersion(fmt.Errorf("no chunks could be embedded with %s", embedder.Name()))
+	}
+	if _, err := dbAI.Collection("memoryIndex").InsertMany(ctx, outDocs); err != nil {
+		return failVersion(fmt.Errorf("failed to insert memoryIndex docs: %w", err))
+	}
+	// Activate it, then drop the chunks of older versions
+	previousVersion := meta.Version
+	var state *EmbedderState
+	if ce, ok := builder.(corpusEmbedder); ok {
+		state = ce.State()
+		if err := embedder.(corpusEmbedder).Restore(state); err != nil {
+			return failVersion(err)
 		}
 	}
-	memoryIndex = newMemory
-	memoryIndexMeta.LastUpdate = now.Format(time.RFC3339)
-	saveMemoryIndexMeta(ctx)
-	log.Printf("✅ Memory index rebuilt (%d items)", len(memoryIndex))
+	meta = indexMeta{
+		LastUpdate:    now.Format(time.RFC3339),
+		Version:       version.Version,
+		Embedder:      embedder.Name(),
+		Dimensions:    newMemory[0].dimensions(),
+		EmbedderState: state,
+	}
+	publishIndex(newMemory, meta, embedder)
+	saveMemoryIndexMeta(ctx, meta)
+	activatedAt := time.Now()
+	version.Status, version.Dimensions, version.Items, version.ActivatedAt = indexVersionActive, meta.Dimensions, len(newMemory), &activatedAt
+	saveIndexVersion(ctx, version)
+	// Version IDs sort by build time; a newer version stored meanwhile is left alone
+	retired := bson.M{"$or": bson.A{
+		bson.M{"version": bson.M{"$lt": version.Version}},
+		bson.M{"version": bson.M{"$exists": false}},
+	}}
+	if _, err := dbAI.Collection("memoryIndex").DeleteMany(ctx, retired); err != nil {
+		log.Println("Error deleting retired memory index versions:", err)
+	}
+	if previousVersion != "" {
+		retireIndexVersion(ctx, previousVersion)
+	}
+	ensureVectorSearchIndex(ctx, meta.Dimensions)
+	saveIndexSnapshot(currentIndex())
+	log.Printf("✅ Memory index rebuilt (%d items, version %q, embedder %s)", len(newMemory), version.Version, embedder.Name())
 	return nil
 }
 
+// loadStoredIndex reads the chunks of an index version from the "memoryIndex" collection.
+func loadStoredIndex(ctx context.Context, version string) ([]MemoryItem, error) {
+	cur, err := config.GetDBAI().Collection("memoryIndex").Find(ctx, indexVersionFilter(version))
+	if err != nil {
+		return nil, err
+	}
+	var docs []struct {
+		Category     string `bson:"category"`
+		Source       string `bson:"source"`
+		Text         string `bson:"text"`
+		storedVector `bson:",inline"`
+	}
+	if err = cur.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	loaded := make([]MemoryItem, 0, len(docs))
+	for _, doc := range docs {
+		item := MemoryItem{Category: doc.Category, Source: doc.Source, Text: doc.Text}
+		if err := doc.storedVector.decode(&item); err != nil {
+			log.Printf("Skipping memory index chunk %s: %v", doc.Source, err)
+			continue
+		}
+		loaded = append(loaded, item)
+	}
+	return loaded, nil
+}
+
+// atlasVectorSearch turns on the Atlas Vector Search index over the "memoryIndex" collection;
+// it needs an Atlas cluster, so the in-process search stays the default.
+var atlasVectorSearch = config.EnvString("AI_ATLAS_VECTOR_SEARCH", "false") == "true"
+
+const (
+	vectorSearchIndexName = "chunkEmbeddingsIndex"
+	// vectorSearchCandidatesPerHit is how many approximate candidates Atlas considers per result.
+	vectorSearchCandidatesPerHit = 20
+)
+
+// vectorSearchIndexDefinition is the Atlas Vector Search index over the chunk embeddings. The
+// category and version fields are filter fields so $vectorSearch can pre-filter on them.
+func vectorSearchIndexDefinition(dimensions int) bson.M {
+	return bson.M{"fields": bson.A{
+		bson.M{"type": "vector", "path": "embedding", "numDimensions": dimensions, "similarity": "cosine"},
+		bson.M{"type": "filter", "path": "category"},
+		bson.M{"type": "filter", "path": "version"},
+	}}
+}
+
+// ensureVectorSearchIndex creates or updates the Atlas Vector Search index for the dimensions of
+// the active embedder.
+func ensureVectorSearchIndex(ctx context.Context, dimensions int) {
+	if !atlasVectorSearch || dimensions == 0 {
+		return
+	}
+	err := config.GetDBAI().Collection("memoryIndex").EnsureSearchIndex(ctx, vectorSearchIndexName, "vectorSearch", vectorSearchIndexDefinition(dimensions))
+	if err != nil {
+		log.Println("Error ensuring the vector search index:", err)
+	}
+}
+
 // semanticSearchWithAtlas performs a vector similarity search per category using Atlas Search (if available).
-func semanticSearchWithAtlas(ctx context.Context, queryEmbedding []float32, topK map[string]int) ([]struct{ Category, Text string; Score float64 }, error) {
+func semanticSearchWithAtlas(ctx context.Context, version string, queryEmbedding []float32, topK map[string]int) ([]struct{ Category, Text string; Score float64 }, error) {
 	db := config.GetDBAI()
 	type resultHit struct {
 		Text  string  `bson:"text"`
@@ -587,15 +796,18 @@ func semanticSearchWithAtlas(ctx context.Context, queryEmbedding []float32, topK
 		wg.Add(1)
 		go func(category string, k int) {
 			defer wg.Done()
-			// Build the aggregate pipeline
-			filter := bson.M{"path": "category", "query": category}
+			// Build the aggregate pipeline. Only the active version's chunks share the query's
+			// vector space, so the version is filtered inside $vectorSearch, before the top k are cut.
+			filter := indexVersionFilter(version)
+			filter["category"] = category
 			vectorStage := bson.M{
 				"$vectorSearch": bson.M{
-					"index":      "chunkEmbeddingsIndex",
-					"queryVector": queryEmbedding,
-					"path":       "embedding",
-					"filter":     bson.M{"term": bson.M{"path": "category", "query": category}},
-					"k":          k,
+					"index":         vectorSearchIndexName,
+					"queryVector":   queryEmbedding,
+					"path":          "embedding",
+					"filter":        filter,
+					"numCandidates": k * vectorSearchCandidatesPerHit,
+					"limit":         k,
 				},
 			}
 			projectStage := bson.M{
@@ -637,19 +849,20 @@ func askWithRAG(query string) (string, error) {
 		return "", fmt.Errorf("Query cannot be empty")
 	}
 	// Ensure memoryIndex is ready
-	if len(memoryIndex) == 0 {
+	if len(currentIndex().Items) == 0 {
 		if err := buildMemoryIndex(context.Background(), false); err != nil {
 			return "", err
 		}
 	}
+	idx := currentIndex()
 	// Create embedding for query
-	qEmb, err := getEmbedding(query)
+	qEmb, err := idx.embed(context.Background(), query)
 	if err != nil {
 		return "", fmt.Errorf("failed to embed query: %w", err)
 	}
 	// Retrieve top hits from each category
-	topK := map[string]int{"db": 10, "github": 5, "resume": 3}
-	hits, err := semanticSearchWithAtlas(context.Background(), qEmb, topK)
+	topK := currentRetrievalProfile().TopK
+	hits, err := semanticSearchWithAtlas(context.Background(), idx.Meta.Version, qEmb, topK)
 	if err != nil {
 		return "", err
 	}
@@ -672,95 +885,234 @@ func askWithRAG(query string) (string, error) {
 	// Prepare system and user messages
 	systemMsg := `You are a precise assistant. Use ONLY the context below, cite by [n].`
 	userMsg := "CONTEXT:\n" + contextBlock + "\nQUESTION: " + query
-	resp, err := config.OpenAIClient.CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{
-		Model:       "gpt-4o-mini",
-		Messages:    []openai.ChatCompletionMessage{{Role: "system", Content: systemMsg}, {Role: "user", Content: userMsg}},
-		Temperature: 0,
-		MaxTokens:   300,
+	answer, _, err := completeTask(context.Background(), taskAnswer, openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{{Role: "system", Content: systemMsg}, {Role: "user", Content: userMsg}},
 	})
 	if err != nil {
 		return "", err
 	}
-	answer := resp.Choices[0].Message.Content
 	return answer, nil
 }
 
 // optimizeQuery uses the LLM to rewrite a user query to be self-contained and precise.
-func optimizeQuery(conversationMemory string, userQuery string) (string, error) {
+// It also returns the prompt template version used.
+func optimizeQuery(ctx context.Context, conversationMemory string, userQuery string) (string, string, error) {
 	if strings.TrimSpace(userQuery) == "" {
-		return "", fmt.Errorf("Query is required")
-	}
-	systemPrompt := `
-You are VENKATA SRIMANNARAYANA YASAM's expert query optimizer for his AI ChatBot, responsible for rewriting user queries to guarantee precise hits across his indexed knowledge base.
-[Rules]
-1. Determine if userQuery follows from conversationMemory.
-2. If yes, integrate essential details from memory (most recent first) to make query self-contained.
-3. If unrelated, rewrite query self-contained.
-4. Add relevant metadata terms (project titles, technologies, skills, certifications) so retrieval matches correct chunks.
-5. Preserve user intent exactly; do not change meaning.
-[Style]
-- Return only the optimized query text, no explanations.
-`.trim()
-	userPrompt := fmt.Sprintf(`
-Conversation Memory:
-%s
-
-User Query: "%s"
-
-Rewrite the user's query according to the above rules, output only the optimized query.
-`, conversationMemory, userQuery)
+		return "", "", fmt.Errorf("Query is required")
+	}
+	// An injection attempt is passed through untouched; ask-chat refuses it
+	if refusal := guardQuery(userQuery); refusal != nil {
+		return userQuery, "", nil
+	}
+	// Resolve "that project" and similar references from the tracked entities before the model
+	// rewrites the query, so the referent doesn't depend on the model's reading of the memory
+	memory := parseConversationMemory(conversationMemory)
+	resolved := memory.resolveReferences(userQuery)
+	prompt, err := renderPrompt(promptOptimizeQuery, promptData{Memory: memory.promptText(), Query: resolved})
+	if err != nil {
+		return "", "", err
+	}
 	messages := []openai.ChatCompletionMessage{
-		{Role: "system", Content: systemPrompt},
-		{Role: "user", Content: strings.TrimSpace(userPrompt)},
-	}
-	resp, err := config.OpenAIClient.CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{
-		Model:       "gpt-4.1-nano",
-		Messages:    messages,
-		MaxTokens:   int(float64(len(userQuery))/2 * 2), // approximate max tokens double the query length
-		Temperature: 0.3,
+		{Role: "system", Content: prompt.System},
+		{Role: "user", Content: prompt.User},
+	}
+	optimized, _, err := completeTask(ctx, taskRewrite, openai.ChatCompletionRequest{
+		Messages:  messages,
+		MaxTokens: int(float64(len(resolved))/2 * 2), // approximate max tokens double the query length, unless the rewrite profile sets one
 	})
 	if err != nil {
-		return "", err
+		return "", prompt.Ref, err
 	}
-	optimized := strings.TrimSpace(resp.Choices[0].Message.Content)
+	optimized = strings.TrimSpace(optimized)
 	// Remove surrounding quotes if present
 	if (strings.HasPrefix(optimized, "\"") && strings.HasSuffix(optimized, "\"")) || (strings.HasPrefix(optimized, "'") && strings.HasSuffix(optimized, "'")) {
 		optimized = optimized[1 : len(optimized)-1]
 	}
 	if optimized == "" {
-		optimized = userQuery
+		optimized = resolved
 	}
-	return optimized, nil
+	return optimized, prompt.Ref, nil
+}
+
+// OptimizeQuery rewrites a visitor query to be self-contained for retrieval and returns the
+// prompt template version used.
+func OptimizeQuery(ctx context.Context, conversationMemory string, query string) (string, string, error) {
+	return optimizeQuery(ctx, conversationMemory, query)
 }
 
 // askLLM retrieves relevant chunks manually and asks the LLM for an answer.
-func askLLM(query string) (string, error) {
+func askLLM(ctx context.Context, query string, conversationMemory string, mode string) (*AskResult, error) {
 	query = strings.TrimSpace(query)
 	if query == "" {
-		return "", fmt.Errorf("Query cannot be empty")
+		return nil, fmt.Errorf("Query cannot be empty")
+	}
+	if mode == "" {
+		mode = AnswerModeRAG
+	} else if mode != AnswerModeRAG && mode != AnswerModeTools {
+		return nil, fmt.Errorf("unknown answer mode %q", mode)
+	}
+	if refusal := guardQuery(query); refusal != nil {
+		return refusal, nil
+	}
+	ensureMemoryIndex()
+	// Answers that depend on conversation memory, live tool data or an admin's model overrides
+	// are neither served from nor stored in the cache
+	useCache := strings.TrimSpace(conversationMemory) == "" && mode == AnswerModeRAG && !hasModelOverrides(ctx)
+	if useCache {
+		if hit := lookupAnswerCacheText(query); hit != nil {
+			return hit, nil
+		}
 	}
-	// Ensure memoryIndex is loaded
-	if len(memoryIndex) == 0 {
-		dbAI := config.GetDBAI()
-		cnt, _ := dbAI.Collection("memoryIndex").CountDocuments(context.Background(), bson.M{})
-		if cnt > 0 {
-			// Load from DB if exists
-			_ = buildMemoryIndex(context.Background(), false)
-		} else {
-			_ = buildMemoryIndex(context.Background(), true)
+	// Over budget, answer without calling the provider
+	if exceeded := overBudget(ctx); exceeded != nil {
+		return degradedAnswer(query, nil, exceeded)
+	}
+	// Compute query embedding for similarity; without it (or without an index) fall back to lexical retrieval.
+	// The query is embedded and scored against the same published index, even if a rebuild swaps it meanwhile.
+	idx := currentIndex()
+	qEmb, err := idx.embed(ctx, query)
+	if err != nil {
+		return degradedAnswer(query, nil, fmt.Errorf("failed to embed query: %w", err))
+	}
+	if len(idx.Items) == 0 {
+		return degradedAnswer(query, nil, fmt.Errorf("memory index unavailable"))
+	}
+	if refusal := guardTopic(query, qEmb, idx); refusal != nil {
+		return refusal, nil
+	}
+	if useCache {
+		if hit := lookupAnswerCache(qEmb); hit != nil {
+			return hit, nil
+		}
+	}
+	selected := guardContext(retrieveContext(query, qEmb, idx.Items, nil, nil))
+	if mode == AnswerModeTools {
+		result, err := askWithTools(ctx, query, conversationMemory, selected)
+		if err != nil {
+			return degradedAnswer(query, selected, err)
 		}
+		result.Sources = contextSources(selected, currentRetrievalProfile().ContextCharLimit)
+		return result, nil
 	}
-	// Compute query embedding for similarity
-	qEmb, err := getEmbedding(query)
+	result, err := generateAnswer(ctx, query, conversationMemory, selected)
 	if err != nil {
-		return "", fmt.Errorf("failed to embed query: %w", err)
+		return degradedAnswer(query, selected, err)
 	}
-	var queryNorm float64
-	for _, v := range qEmb {
-		queryNorm += float64(v) * float64(v)
+	result.Sources = contextSources(selected, currentRetrievalProfile().ContextCharLimit)
+	result.Mode = mode
+	if useCache {
+		storeAnswerCache(query, qEmb, result)
+	}
+	return result, nil
+}
+
+// AskLLM answers a visitor question using the indexed context. mode is AnswerModeRAG (the
+// default when empty) or AnswerModeTools. ctx may carry admin model overrides and the
+// visitor's original query. Answers whose trace was saved get an ID that visitors rate them by.
+func AskLLM(ctx context.Context, query string, conversationMemory string, mode string) (*AskResult, error) {
+	result, err := askLLM(ctx, query, conversationMemory, mode)
+	if err == nil {
+		recordAnswerTrace(ctx, query, conversationMemory, mode, result)
+	}
+	return result, err
+}
+
+// Answer modes of AskLLM
+const (
+	AnswerModeRAG   = "rag"   // answer from retrieved chunks only
+	AnswerModeTools = "tools" // retrieved chunks plus live portfolio data tools
+)
+
+// AskResult is the answer to a visitor question and the chunks it was grounded on.
+type AskResult struct {
+	ID              string           `json:"id,omitempty"` // answer ID for visitor feedback
+	Answer          string           `json:"answer"`
+	Sources         []string         `json:"sources"`
+	Cached          bool             `json:"cached"`
+	CacheSimilarity float64          `json:"cacheSimilarity,omitempty"`
+	Refused         bool             `json:"refused,omitempty"` // a guardrail answered instead of the model
+	Mode            string           `json:"mode,omitempty"`
+	ToolTrace       []ToolCallRecord `json:"toolTrace,omitempty"` // tool calls made in tools mode
+	Degraded        bool             `json:"degraded,omitempty"`  // extractive answer, the chat model was unavailable
+	Notice          string           `json:"notice,omitempty"`    // explanation shown with degraded answers
+	Prompt          string           `json:"prompt,omitempty"`    // prompt template version, e.g. "answer@v2"
+	Model           string           `json:"model,omitempty"`     // chat model that wrote the answer
+}
+
+// ensureMemoryIndex loads the memory index from the DB, or builds it if none is stored yet.
+// A build already running is waited for and its version loaded instead of built again.
+func ensureMemoryIndex() {
+	if len(currentIndex().Items) == 0 {
+		_ = buildMemoryIndex(context.Background(), false)
+	}
+}
+
+// buildContextBlock joins the selected chunks into the prompt context (limited to charLimit
+// characters) and returns how many chunks fit.
+func buildContextBlock(selected []MemoryItem, charLimit int) (string, int) {
+	var ctxLines []string
+	var ctxLen int
+	for _, item := range selected {
+		line := strings.ReplaceAll(item.Text, "\n", " ")
+		if ctxLen+len(line)+2 > charLimit { // +2 for newlines
+			break
+		}
+		ctxLines = append(ctxLines, line)
+		ctxLen += len(line) + 2
+	}
+	return strings.Join(ctxLines, "\n\n"), len(ctxLines)
+}
+
+// contextSources returns the source ids of the selected chunks that fit in the prompt context.
+func contextSources(selected []MemoryItem, charLimit int) []string {
+	_, n := buildContextBlock(selected, charLimit)
+	sources := make([]string, 0, n)
+	for _, item := range selected[:n] {
+		sources = append(sources, item.Source)
+	}
+	return sources
+}
+
+// generateAnswer builds the context block from the selected chunks and asks the answer model
+// for an answer. The result records the prompt template version and model used.
+func generateAnswer(ctx context.Context, query string, conversationMemory string, selected []MemoryItem) (*AskResult, error) {
+	contextBlock, _ := buildContextBlock(selected, currentRetrievalProfile().ContextCharLimit)
+	prompt, err := answerPrompt(query, conversationMemory, contextBlock, false)
+	if err != nil {
+		return nil, err
+	}
+	answer, model, err := completeTask(ctx, taskAnswer, openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{
+			{Role: "system", Content: prompt.System},
+			{Role: "user", Content: prompt.User},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &AskResult{Answer: strings.TrimSpace(answer), Prompt: prompt.Ref, Model: model}, nil
+}
+
+// answerPrompt renders the answer template: the hardened system prompt and the memory, context
+// and question, everything visitor- or data-supplied between delimiters.
+func answerPrompt(query, conversationMemory, contextBlock string, tools bool) (*renderedPrompt, error) {
+	data := promptData{Tools: tools, Context: contextBlock, Query: query}
+	if strings.TrimSpace(conversationMemory) != "" {
+		data.Memory = parseConversationMemory(conversationMemory).promptText()
+	}
+	return renderPrompt(promptAnswer, data)
+}
+
+// retrieveContext scores every item of index against the query embedding, applies the
+// category weights, query boosts and filters, and returns the budgeted selection of chunks.
+// A nil profile uses the active retrieval profile. When trace is non-nil every scoring and
+// filter decision is recorded in it.
+func retrieveContext(query string, qEmb []float32, index []MemoryItem, profile *RetrievalProfile, trace *RetrievalTrace) []MemoryItem {
+	if profile == nil {
+		profile = currentRetrievalProfile()
 	}
-	queryNorm = sqrt(queryNorm)
 	// Calculate cosine similarity for each memory item
+	scores := scoreIndex(qEmb, index)
 	buckets := map[string][]struct {
 		Item          *MemoryItem
 		Score         float64
@@ -768,102 +1120,102 @@ func askLLM(query string) (string, error) {
 	}{
 		"db": {}, "resume": {}, "github": {},
 	}
-	for i, item := range memoryIndex {
-		// Compute cosine similarity
-		var dot float64
-		for j, x := range item.Embedding {
-			dot += float64(x) * float64(qEmb[j])
-		}
-		var cosSim float64
-		if item.Norm != 0 && queryNorm != 0 {
-			cosSim = dot / (item.Norm * queryNorm)
-		} else {
+	for i, item := range index {
+		cosSim := scores[i]
+		// Vectors from another embedder (e.g. mid-migration) have a different size and can't match
+		if math.IsNaN(cosSim) {
 			cosSim = 0
 		}
 		wi := struct {
 			Item          *MemoryItem
 			Score         float64
 			WeightedScore float64
-		}{Item: &memoryIndex[i], Score: cosSim, WeightedScore: cosSim}
+		}{Item: &index[i], Score: cosSim, WeightedScore: cosSim}
 		// Apply category weight
-		if w, ok := categoryWeights[item.Category]; ok {
+		weight := 1.0
+		if w, ok := profile.CategoryWeights[item.Category]; ok {
+			weight = w
 			wi.WeightedScore = wi.Score * w
 		}
+		trace.addCandidate(wi.Item, cosSim, weight)
 		buckets[item.Category] = append(buckets[item.Category], wi)
 	}
-	// Query-based boosts:
-	ql := strings.ToLower(query)
-	if strings.Contains(ql, "resume") {
-		for i := range buckets["resume"] {
-			buckets["resume"][i].WeightedScore += queryBoost["resume"]
-		}
-	}
-	if strings.Contains(ql, "github") {
-		for i := range buckets["github"] {
-			buckets["github"][i].WeightedScore += queryBoost["github"]
+	// Intent-driven boosts: each category gets its query boost scaled by the confidence of the
+	// most confident detected intent that points at it
+	intents := classifyIntents(qEmb, profile)
+	trace.setIntents(intents)
+	plan := planFromIntents(intents)
+	for _, cat := range retrievalCategories {
+		conf := plan.categoryConfidence[cat]
+		if conf == 0 {
+			continue
 		}
-	}
-	for _, term := range dbTerms {
-		if strings.Contains(ql, term) {
-			for i := range buckets["db"] {
-				buckets["db"][i].WeightedScore += queryBoost["db"]
-			}
-			break
+		boost := profile.QueryBoost[cat] * conf
+		for i := range buckets[cat] {
+			buckets[cat][i].WeightedScore += boost
+			trace.addBoost(buckets[cat][i].Item, boost)
 		}
 	}
-	// Drop honors/yearInReview DB chunks if query doesn't mention them
+	// Drop honors/yearInReview DB chunks unless the matching intent was detected
 	for idx := 0; idx < len(buckets["db"]); {
 		chunk := buckets["db"][idx]
 		prefix := strings.ToLower(strings.Split(chunk.Item.Text, " - ")[0])
-		if (strings.Contains(prefix, "honors") || strings.Contains(prefix, "year in review")) &&
-			!strings.Contains(ql, "honors") && !strings.Contains(ql, "year in review") {
+		if (strings.Contains(prefix, "honors") && plan.dbLabelConfidence["honors"] == 0) ||
+			(strings.Contains(prefix, "year in review") && plan.dbLabelConfidence["year in review"] == 0) {
 			// remove this chunk
+			trace.drop(chunk.Item, "honors/yearInReview chunk without a matching intent")
 			buckets["db"] = append(buckets["db"][:idx], buckets["db"][idx+1:]...)
 		} else {
 			idx++
 		}
 	}
-	// Boost specific DB subcategories mentioned
+	// Boost DB subcategories targeted by a detected intent (up to 1.2x at full confidence)
 	for i := range buckets["db"] {
 		prefix := strings.ToLower(strings.Split(buckets["db"][i].Item.Text, " - ")[0])
-		for _, term := range dbTerms {
-			if strings.Contains(prefix, term) && strings.Contains(ql, term) {
-				buckets["db"][i].WeightedScore *= 1.2
-			}
+		if conf, label := plan.dbLabelMatch(prefix); conf > 0 {
+			factor := 1 + 0.2*conf
+			buckets["db"][i].WeightedScore *= factor
+			trace.multiply(buckets["db"][i].Item, factor, "intent "+plan.intentFor[label]+": db "+label)
 		}
 	}
-	// Filter resume chunks by heading if not mentioned
+	// Filter resume sections whose heading no detected intent asks for
 	for idx := 0; idx < len(buckets["resume"]); {
 		chunk := buckets["resume"][idx]
 		heading := strings.ToLower(strings.Fields(chunk.Item.Text)[0])
 		heading = strings.TrimSpace(regexp.MustCompile(`[^a-z0-9\s]`).ReplaceAllString(heading, ""))
-		if containsString(resumeTerms, heading) && !strings.Contains(ql, heading) {
+		if containsString(profile.ResumeTerms, heading) && plan.headingConfidence[heading] == 0 {
+			trace.drop(chunk.Item, fmt.Sprintf("resume heading %q without a matching intent", heading))
 			buckets["resume"] = append(buckets["resume"][:idx], buckets["resume"][idx+1:]...)
 		} else {
 			idx++
 		}
 	}
-	// Boost any resume chunk whose heading appears in query
+	// Boost resume sections targeted by a detected intent (up to 1.2x at full confidence)
 	for i := range buckets["resume"] {
 		heading := strings.ToLower(strings.Fields(buckets["resume"][i].Item.Text)[0])
 		heading = strings.TrimSpace(regexp.MustCompile(`[^a-z0-9\s]`).ReplaceAllString(heading, ""))
-		if containsString(resumeTerms, heading) && strings.Contains(ql, heading) {
-			buckets["resume"][i].WeightedScore *= 1.2
+		if conf := plan.headingConfidence[heading]; conf > 0 {
+			factor := 1 + 0.2*conf
+			buckets["resume"][i].WeightedScore *= factor
+			trace.multiply(buckets["resume"][i].Item, factor, "intent "+plan.intentFor[heading]+": resume "+heading)
 		}
 	}
 	// Sort each bucket by WeightedScore and cap to max counts
-	maxCounts := map[string]int{"db": 6, "resume": 3, "github": 3}
+	maxCounts := profile.MaxCounts
 	for cat, arr := range buckets {
 		sort.Slice(arr, func(i, j int) bool { return arr[i].WeightedScore > arr[j].WeightedScore })
 		if len(arr) > maxCounts[cat] {
+			for _, wi := range arr[maxCounts[cat]:] {
+				trace.drop(wi.Item, fmt.Sprintf("below top %d of category %s", maxCounts[cat], cat))
+			}
 			buckets[cat] = arr[:maxCounts[cat]]
 		} else {
 			buckets[cat] = arr
 		}
 	}
-	// Allocate total budget of 12 among categories dynamically
-	totalBudget := 12
-	minAlloc := map[string]int{"db": 1, "resume": 1, "github": 0}
+	// Allocate the total budget among categories dynamically
+	totalBudget := profile.TotalBudget
+	minAlloc := profile.MinAlloc
 	maxAlloc := maxCounts
 	signals := make(map[string]float64)
 	for cat, arr := range buckets {
@@ -876,7 +1228,9 @@ func askLLM(query string) (string, error) {
 	selected := []MemoryItem{}
 	// initial allocate minimums
 	remaining := totalBudget
-	for cat, min := range minAlloc {
+	// Walk categories in a fixed order so the selection (and its order) is reproducible
+	for _, cat := range retrievalCategories {
+		min := minAlloc[cat]
 		if len(buckets[cat]) == 0 {
 			continue
 		}
@@ -885,6 +1239,9 @@ func askLLM(query string) (string, error) {
 			take = len(buckets[cat])
 		}
 		selected = append(selected, extractTopItems(buckets[cat], take)...)
+		for _, wi := range buckets[cat][:take] {
+			trace.selectItem(wi.Item, cat)
+		}
 		remaining -= take
 	}
 	if remaining < 0 {
@@ -901,7 +1258,8 @@ func askLLM(query string) (string, error) {
 			}
 			totalSignal += sig
 		}
-		for cat, arr := range buckets {
+		for _, cat := range retrievalCategories {
+			arr := buckets[cat]
 			if len(arr) == 0 || remaining <= 0 {
 				continue
 			}
@@ -926,156 +1284,20 @@ func askLLM(query string) (string, error) {
 			}
 			if alloc > 0 {
 				selected = append(selected, extractTopItems(arr[minAlloc[cat]:], alloc)...)
+				for _, wi := range arr[minAlloc[cat] : minAlloc[cat]+alloc] {
+					trace.selectItem(wi.Item, cat)
+				}
 				remaining -= alloc
 			}
 		}
 	}
-	// Build context string (limit ~8000 chars)
-	var ctxLines []string
-	var ctxLen int
-	for _, item := range selected {
-		line := strings.ReplaceAll(item.Text, "\n", " ")
-		if ctxLen+len(line)+2 > 8000 { // +2 for newlines
-			break
-		}
-		ctxLines = append(ctxLines, line)
-		ctxLen += len(line) + 2
-	}
-	contextBlock := strings.Join(ctxLines, "\n\n")
-	// Prepare prompts
-	userPrompt := ""
-	if strings.TrimSpace(conversationMemory) != "" {
-		userPrompt = fmt.Sprintf("MEMORY:\n%s\nCONTEXT:\n%s\n\nQUESTION: %s", conversationMemory, contextBlock, query)
-	} else {
-		userPrompt = fmt.Sprintf("CONTEXT:\n%s\n\nQUESTION: %s", contextBlock, query)
-	}
-	systemPrompt := `
-You are VENKATA SRIMANNARAYANA YASAM's expert query optimizer for his AI ChatBot, responsible for rewriting user queries to guarantee precise hits across his indexed knowledge base.
-[Rules]
-1. Determine if userQuery follows from conversationMemory.
-2. If yes, integrate essential details from memory (most recent first) to make query self-contained.
-3. If unrelated, rewrite query self-contained.
-4. Add relevant metadata terms (project titles, technologies, skills, certifications) so retrieval matches correct chunks.
-5. Preserve user intent exactly; do not change meaning.
-[Style]
-- Return only the optimized query text, no explanations.
-`.trim()
-	resp, err := config.OpenAIClient.CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{
-		Model: "gpt-4.1-nano",
-		Messages: []openai.ChatCompletionMessage{
-			{Role: "system", Content: systemPrompt},
-			{Role: "user", Content: userPrompt},
-		},
-		MaxTokens: 400,
-		Temperature: 0.3,
-	})
-	if err != nil {
-		return "", err
-	}
-	answer := resp.Choices[0].Message.Content
-	return strings.TrimSpace(answer), nil
-}
-
-// suggestFollowUpQuestions uses the LLM to generate three follow-up questions given the last Q&A.
-func suggestFollowUpQuestions(query string, response string, conversationMemory string) ([]string, error) {
-	if strings.TrimSpace(query) == "" || strings.TrimSpace(response) == "" {
-		return nil, fmt.Errorf("Both query and response are required")
-	}
-	systemContent := `
-You are VENKATA SRIMANNARAYANA YASAM's expert query optimizer for his AI ChatBot, responsible for rewriting user queries to guarantee precise hits across his indexed knowledge base.
-[Rules]
-1. Determine if userQuery follows from conversationMemory.
-2. If yes, integrate essential details from memory (most recent first) to make query self-contained.
-3. If unrelated, rewrite query self-contained.
-4. Add relevant metadata terms (project titles, technologies, skills, certifications) so retrieval matches correct chunks.
-5. Preserve user intent exactly; do not change meaning.
-[Style]
-- Return only the optimized query text, no explanations.
-`.trim()
-	userContent := fmt.Sprintf(`User's question: "%s"
-Assistant's answer: "%s"
-Based on this exchange, suggest three follow-up questions the user might ask next.`, query, response)
-	resp, err := config.OpenAIClient.CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{
-		Model: "gpt-4.1-nano",
-		Messages: []openai.ChatCompletionMessage{
-			{Role: "system", Content: systemContent},
-			{Role: "user", Content: userContent},
-		},
-		Temperature: 0.6,
-		MaxTokens: 100,
-	})
-	if err != nil {
-		return nil, err
-	}
-	rawOutput := resp.Choices[0].Message.Content
-	lines := strings.Split(rawOutput, "\n")
-	var suggestions []string
-	for _, ln := range lines {
-		ln = strings.TrimSpace(ln)
-		ln = strings.TrimLeft(ln, "-0123456789. )") // remove list markers or numbering
-		if ln != "" {
-			suggestions = append(suggestions, ln)
-		}
-		if suggestions.length == 3 {
-			break
-		}
-	}
-	if len(suggestions) > 3 {
-		suggestions = suggestions[:3]
-	}
-	return suggestions, nil
-}
-
-// snapshotMemoryUpdate uses the LLM to update the conversation memory summary with the latest Q&A.
-func snapshotMemoryUpdate(previousMemory string, query string, answer string) (string, error) {
-	if strings.TrimSpace(query) == "" || strings.TrimSpace(answer) == "" {
-		return "", fmt.Errorf("Query and response are required for memory update")
-	}
-	systemContent := `
-You are an assistant bot maintaining a compact memory of the conversation.
-Rules:
-1. Produce one updated summary integrating the new Q&A with prior memory.
-2. If new Q&A is related, add 2-3 short sentences describing it.
-3. If not related, compress previousMemory then add 2-3 sentences for new Q&A.
-4. Always keep important context, limit total memory to ~200 words.
-5. Use third-person: "User asked..., Assistant answered...".
-`.trim()
-	userContent := fmt.Sprintf("Previous memory:\n%s\n\nUser's question: \"%s\"\nAssistant's answer: \"%s\"\n\nUpdate the conversation memory according to the rules.", previousMemory, query, answer)
-	resp, err := config.OpenAIClient.CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{
-		Model: "gpt-4.1-nano",
-		Messages: []openai.ChatCompletionMessage{
-			{Role: "system", Content: systemContent},
-			{Role: "user", Content: userContent},
-		},
-		Temperature: 0.2,
-		MaxTokens: 150,
-	})
-	if err != nil {
-		return "", err
-	}
-	updatedMemory := strings.TrimSpace(resp.Choices[0].Message.Content)
-	return updatedMemory, nil
+	trace.finish(signals, totalBudget, remaining)
+	return selected
 }
 
-// Helper to call OpenAI Embeddings API
-func getEmbedding(text string) ([]float32, error) {
-	resp, err := config.OpenAIClient.CreateEmbeddings(context.Background(), openai.EmbeddingRequest{
-		Model: "text-embedding-3-small",
-		Input: []string{text},
-	})
-	if err != nil {
-		return nil, err
-	}
-	if len(resp.Data) == 0 {
-		return nil, fmt.Errorf("no embedding returned")
-	}
-	embedding := resp.Data[0].Embedding
-	// Convert []float64 to []float32 for memory efficiency
-	vec := make([]float32, len(embedding))
-	for i, v := range embedding {
-		vec[i] = float32(v)
-	}
-	return vec, nil
+// Helper to embed text with the active embedder
+func getEmbedding(ctx context.Context, text string) ([]float32, error) {
+	return activeEmbedder().Embed(ctx, text)
 }
 
 // getDbContextFile returns the latest DB context snapshot as a JSON string.
@@ -0,0 +1,174 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RetrievalCandidate records how a single memory item was scored and filtered during retrieval.
+type RetrievalCandidate struct {
+	Source         string   `json:"source"`
+	Category       string   `json:"category"`
+	Preview        string   `json:"preview"`
+	Cosine         float64  `json:"cosine"`
+	CategoryWeight float64  `json:"categoryWeight"`
+	QueryBoost     float64  `json:"queryBoost"`
+	Multiplier     float64  `json:"multiplier"`
+	MultiplierWhy  []string `json:"multiplierReasons,omitempty"`
+	WeightedScore  float64  `json:"weightedScore"`
+	Dropped        string   `json:"dropped,omitempty"`
+	Selected       bool     `json:"selected"`
+	SelectedRank   int      `json:"selectedRank,omitempty"`
+}
+
+// RetrievalTrace collects the decisions made by retrieveContext. A nil trace records nothing.
+type RetrievalTrace struct {
+	Query           string                `json:"query"`
+	Intents         []QueryIntent         `json:"intents"`
+	Candidates      []*RetrievalCandidate `json:"candidates"`
+	Signals         map[string]float64    `json:"signals"`
+	Allocation      map[string]int        `json:"allocation"`
+	TotalBudget     int                   `json:"totalBudget"`
+	UnusedBudget    int                   `json:"unusedBudget"`
+	ContextIncluded int                   `json:"contextIncluded"`
+	ContextChars    int                   `json:"contextChars"`
+
+	byItem map[*MemoryItem]*RetrievalCandidate
+}
+
+// newRetrievalTrace creates an empty trace for query.
+func newRetrievalTrace(query string) *RetrievalTrace {
+	return &RetrievalTrace{
+		Query:      query,
+		Allocation: map[string]int{},
+		byItem:     map[*MemoryItem]*RetrievalCandidate{},
+	}
+}
+
+func (t *RetrievalTrace) addCandidate(item *MemoryItem, cosine, weight float64) {
+	if t == nil {
+		return
+	}
+	preview := strings.ReplaceAll(item.Text, "\n", " ")
+	if len(preview) > 120 {
+		preview = preview[:117] + "..."
+	}
+	c := &RetrievalCandidate{
+		Source:         item.Source,
+		Category:       item.Category,
+		Preview:        preview,
+		Cosine:         cosine,
+		CategoryWeight: weight,
+		Multiplier:     1,
+	}
+	t.byItem[item] = c
+	t.Candidates = append(t.Candidates, c)
+}
+
+func (t *RetrievalTrace) setIntents(intents []QueryIntent) {
+	if t == nil {
+		return
+	}
+	t.Intents = intents
+}
+
+func (t *RetrievalTrace) addBoost(item *MemoryItem, boost float64) {
+	if t == nil || t.byItem[item] == nil {
+		return
+	}
+	t.byItem[item].QueryBoost += boost
+}
+
+func (t *RetrievalTrace) multiply(item *MemoryItem, factor float64, reason string) {
+	if t == nil || t.byItem[item] == nil {
+		return
+	}
+	c := t.byItem[item]
+	c.Multiplier *= factor
+	c.MultiplierWhy = append(c.MultiplierWhy, reason)
+}
+
+func (t *RetrievalTrace) drop(item *MemoryItem, reason string) {
+	if t == nil || t.byItem[item] == nil {
+		return
+	}
+	t.byItem[item].Dropped = reason
+}
+
+func (t *RetrievalTrace) selectItem(item *MemoryItem, category string) {
+	if t == nil || t.byItem[item] == nil {
+		return
+	}
+	c := t.byItem[item]
+	c.Selected = true
+	t.Allocation[category]++
+	c.SelectedRank = 0
+	for _, other := range t.Candidates {
+		if other.Selected {
+			c.SelectedRank++
+		}
+	}
+}
+
+// finish records the budget split and computes each candidate's final weighted score.
+func (t *RetrievalTrace) finish(signals map[string]float64, totalBudget, remaining int) {
+	if t == nil {
+		return
+	}
+	t.Signals = signals
+	t.TotalBudget = totalBudget
+	t.UnusedBudget = remaining
+	for _, c := range t.Candidates {
+		c.WeightedScore = (c.Cosine*c.CategoryWeight + c.QueryBoost) * c.Multiplier
+	}
+	sort.SliceStable(t.Candidates, func(i, j int) bool {
+		return t.Candidates[i].WeightedScore > t.Candidates[j].WeightedScore
+	})
+}
+
+// DebugRetrieve runs the askLLM retrieval path for a query without calling the chat model and
+// returns every candidate with its scoring breakdown, filter decisions and budget allocation.
+func DebugRetrieve(c *gin.Context) {
+	var req struct {
+		Query   string `json:"query"`
+		Profile string `json:"profile"` // optional: trace a stored profile other than the active one
+	}
+	if err := c.BindJSON(&req); err != nil || strings.TrimSpace(req.Query) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Query cannot be empty"})
+		return
+	}
+	query := strings.TrimSpace(req.Query)
+	profile := currentRetrievalProfile()
+	if req.Profile != "" {
+		p, err := loadRetrievalProfile(c.Request.Context(), req.Profile)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Retrieval profile not found"})
+			return
+		}
+		profile = p
+	}
+	ensureMemoryIndex()
+	idx := currentIndex()
+	qEmb, err := idx.embed(c.Request.Context(), query)
+	if err != nil {
+		log.Println("Error embedding debug query:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to embed query", "error": err.Error()})
+		return
+	}
+	trace := newRetrievalTrace(query)
+	selected := retrieveContext(query, qEmb, idx.Items, profile, trace)
+	contextBlock, included := buildContextBlock(selected, profile.ContextCharLimit)
+	trace.ContextIncluded = included
+	trace.ContextChars = len(contextBlock)
+	c.JSON(http.StatusOK, gin.H{
+		"indexSize": len(idx.Items),
+		"provider":  aiProvider.Name(),
+		"embedder":  idx.embedder().Name(),
+		"profile":   profile.Name,
+		"trace":     trace,
+	})
+}
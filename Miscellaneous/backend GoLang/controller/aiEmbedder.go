@@ -0,0 +1,251 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math"
+	"strings"
+	"sync"
+
+	"example.com/portfolio-backend/config"
+)
+
+// Embedder turns text into vectors for retrieval. Every Provider is an Embedder; a separate
+// embedder can be configured so retrieval works without the provider's embedding API.
+type Embedder interface {
+	Name() string
+	Embed(ctx context.Context, text string) ([]float32, error)
+}
+
+// corpusEmbedder is an embedder whose vectors depend on statistics fitted on the indexed
+// corpus. Its state is stored with the memory index meta so query vectors match the index.
+type corpusEmbedder interface {
+	Embedder
+	Fit(texts []string)
+	State() *EmbedderState
+	Restore(state *EmbedderState) error
+	Generation() int // increases on every Fit or Restore
+	Unfitted() corpusEmbedder
+}
+
+// EmbedderState is the fitted state of a corpus embedder.
+type EmbedderState struct {
+	Dimensions int   `bson:"dimensions" json:"dimensions"`
+	Documents  int   `bson:"documents" json:"documents"`
+	DocFreq    []int `bson:"docFreq" json:"docFreq"` // documents containing a feature, per hash bucket
+}
+
+// aiEmbedder overrides the provider's embeddings when set (AI_EMBEDDER=local).
+var aiEmbedder = embedderFromEnv()
+
+// embedderFromEnv returns the embedder selected by AI_EMBEDDER: "local" for the offline
+// TF-IDF embedder, empty or "provider" to embed with the active provider.
+func embedderFromEnv() Embedder {
+	switch name := strings.ToLower(strings.TrimSpace(config.EnvString("AI_EMBEDDER", "provider"))); name {
+	case "provider":
+		return nil
+	case "local":
+		return NewLocalEmbedder(config.EnvInt("AI_LOCAL_EMBEDDING_DIM", defaultLocalEmbeddingDim))
+	default:
+		log.Printf("Unknown AI_EMBEDDER=%q, embedding with the provider", name)
+		return nil
+	}
+}
+
+// SetEmbedder replaces the active embedder; nil embeds with the active provider.
+func SetEmbedder(e Embedder) {
+	aiEmbedder = e
+}
+
+// configuredEmbedder returns the embedder new index versions are built with.
+func configuredEmbedder() Embedder {
+	if aiEmbedder != nil {
+		return aiEmbedder
+	}
+	return aiProvider
+}
+
+// activeEmbedder returns the embedder for queries: the one that produced the served index,
+// which differs from the configured one while a migration is running.
+func activeEmbedder() Embedder {
+	return currentIndex().embedder()
+}
+
+// embedderFamily groups embedders whose cosine similarities share a scale, for cut-offs that
+// are calibrated per embedder: "openai" (any model), "local" (TF-IDF of any size) or "fake".
+func embedderFamily(e Embedder) string {
+	switch e.(type) {
+	case *LocalEmbedder:
+		return "local"
+	case FakeProvider:
+		return "fake"
+	}
+	return "openai"
+}
+
+// embedderID identifies the vectors the active embedder currently produces, including the
+// fitted state of corpus embedders, for caches of derived vectors.
+func embedderID() string {
+	e := activeEmbedder()
+	if ce, ok := e.(corpusEmbedder); ok {
+		return fmt.Sprintf("%s#%d", e.Name(), ce.Generation())
+	}
+	return e.Name()
+}
+
+// fitEmbedder fits a corpus embedder on the chunks about to be embedded; other embedders are left alone.
+func fitEmbedder(e Embedder, chunks []MemoryItem) {
+	ce, ok := e.(corpusEmbedder)
+	if !ok {
+		return
+	}
+	texts := make([]string, 0, len(chunks))
+	for _, chunk := range chunks {
+		if strings.TrimSpace(chunk.Text) != "" {
+			texts = append(texts, chunk.Text)
+		}
+	}
+	ce.Fit(texts)
+}
+
+// defaultLocalEmbeddingDim is the vector size of the local embedder unless AI_LOCAL_EMBEDDING_DIM is set.
+const defaultLocalEmbeddingDim = 4096
+
+// LocalEmbedder is an offline, pure-Go embedder: unigrams and bigrams are feature-hashed into
+// Dim buckets (with a hash bit as sign), weighted by sublinear term frequency and the inverse
+// document frequency of their bucket in the fitted corpus, and L2-normalised. Before Fit every
+// bucket has the same weight.
+type LocalEmbedder struct {
+	Dim        int
+	mu         sync.RWMutex
+	idf        []float64
+	state      *EmbedderState
+	generation int
+}
+
+// NewLocalEmbedder returns an unfitted local embedder producing dim-sized vectors.
+func NewLocalEmbedder(dim int) *LocalEmbedder {
+	if dim <= 0 {
+		dim = defaultLocalEmbeddingDim
+	}
+	return &LocalEmbedder{Dim: dim}
+}
+
+func (e *LocalEmbedder) Name() string { return fmt.Sprintf("local-tfidf-%d", e.Dim) }
+
+// features returns the hashed features of text with their counts; a negative bucket+1
+// marks a feature whose sign hash bit is set.
+func (e *LocalEmbedder) features(text string) map[int]int {
+	tokens := tokenize(text)
+	counts := map[int]int{}
+	add := func(feature string) {
+		h := fnv.New32a()
+		h.Write([]byte(feature))
+		sum := h.Sum32()
+		key := int(sum>>1) % e.Dim
+		if sum&1 == 1 {
+			key = -key - 1
+		}
+		counts[key]++
+	}
+	for i, tok := range tokens {
+		add(tok)
+		if i > 0 {
+			add(tokens[i-1] + " " + tok)
+		}
+	}
+	return counts
+}
+
+// bucket strips the sign marker from a feature key.
+func bucket(key int) int {
+	if key < 0 {
+		return -key - 1
+	}
+	return key
+}
+
+// Fit computes bucket document frequencies over texts.
+func (e *LocalEmbedder) Fit(texts []string) {
+	state := &EmbedderState{Dimensions: e.Dim, Documents: len(texts), DocFreq: make([]int, e.Dim)}
+	for _, text := range texts {
+		seen := map[int]bool{}
+		for key := range e.features(text) {
+			if b := bucket(key); !seen[b] {
+				seen[b] = true
+				state.DocFreq[b]++
+			}
+		}
+	}
+	e.setState(state)
+}
+
+// State returns the fitted state, or nil before Fit/Restore.
+func (e *LocalEmbedder) State() *EmbedderState {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.state
+}
+
+// Restore loads a state saved by State.
+func (e *LocalEmbedder) Restore(state *EmbedderState) error {
+	if state == nil || state.Dimensions != e.Dim || len(state.DocFreq) != e.Dim {
+		return fmt.Errorf("embedder state does not match %s", e.Name())
+	}
+	e.setState(state)
+	return nil
+}
+
+// Unfitted returns a new embedder with the same settings and no fitted state.
+func (e *LocalEmbedder) Unfitted() corpusEmbedder { return NewLocalEmbedder(e.Dim) }
+
+func (e *LocalEmbedder) Generation() int {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.generation
+}
+
+func (e *LocalEmbedder) setState(state *EmbedderState) {
+	idf := make([]float64, e.Dim)
+	n := float64(state.Documents)
+	for i, df := range state.DocFreq {
+		idf[i] = math.Log((1+n)/(1+float64(df))) + 1
+	}
+	e.mu.Lock()
+	e.state, e.idf = state, idf
+	e.generation++
+	e.mu.Unlock()
+}
+
+func (e *LocalEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	e.mu.RLock()
+	idf := e.idf
+	e.mu.RUnlock()
+	weights := make([]float64, e.Dim)
+	for key, count := range e.features(text) {
+		w := 1 + math.Log(float64(count))
+		b := bucket(key)
+		if idf != nil {
+			w *= idf[b]
+		}
+		if key < 0 {
+			w = -w
+		}
+		weights[b] += w
+	}
+	var sum float64
+	for _, w := range weights {
+		sum += w * w
+	}
+	vec := make([]float32, e.Dim)
+	if sum == 0 {
+		return vec, nil
+	}
+	norm := math.Sqrt(sum)
+	for i, w := range weights {
+		vec[i] = float32(w / norm)
+	}
+	return vec, nil
+}
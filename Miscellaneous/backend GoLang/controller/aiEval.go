@@ -0,0 +1,334 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	openai "github.com/sashabaranov/go-openai"
+	"gopkg.in/yaml.v3"
+)
+
+// GoldenQuestion is one evaluation case: a visitor question and the documents that should answer it.
+type GoldenQuestion struct {
+	ID              string   `json:"id" yaml:"id"`
+	Question        string   `json:"question" yaml:"question"`
+	Category        string   `json:"category,omitempty" yaml:"category,omitempty"`
+	ExpectedSources []string `json:"expectedSources" yaml:"expectedSources"`
+	ExpectedAnswer  string   `json:"expectedAnswer,omitempty" yaml:"expectedAnswer,omitempty"`
+	Note            string   `json:"note,omitempty" yaml:"note,omitempty"` // curator notes, e.g. the feedback a case came from
+}
+
+// GoldenSet is a named collection of golden questions loaded from JSON or YAML.
+type GoldenSet struct {
+	Name      string           `json:"name" yaml:"name"`
+	Questions []GoldenQuestion `json:"questions" yaml:"questions"`
+}
+
+// EvalOptions controls a retrieval evaluation run.
+type EvalOptions struct {
+	K       int               // cut-off for recall@k and MRR
+	Grade   bool              // also generate and grade answers with the active provider
+	Profile *RetrievalProfile // retrieval profile to evaluate; nil uses the active one
+}
+
+// EvalQuestionResult holds the per-question retrieval metrics.
+type EvalQuestionResult struct {
+	ID             string   `json:"id"`
+	Question       string   `json:"question"`
+	Category       string   `json:"category"`
+	Retrieved      []string `json:"retrieved"`
+	Missed         []string `json:"missed,omitempty"`
+	Recall         float64  `json:"recall"`
+	ReciprocalRank float64  `json:"reciprocalRank"`
+	Answer         string   `json:"answer,omitempty"`
+	Grade          *float64 `json:"grade,omitempty"`
+	GradeNote      string   `json:"gradeNote,omitempty"`
+}
+
+// EvalReport aggregates the metrics of an evaluation run.
+type EvalReport struct {
+	Set             string               `json:"set"`
+	Provider        string               `json:"provider"`
+	Embedder        string               `json:"embedder"`
+	Profile         string               `json:"profile"`
+	IndexSize       int                  `json:"indexSize"`
+	K               int                  `json:"k"`
+	Questions       int                  `json:"questions"`
+	RecallAtK       float64              `json:"recallAtK"`
+	MRR             float64              `json:"mrr"`
+	CategoryHitRate map[string]float64   `json:"categoryHitRate"`
+	Graded          int                  `json:"graded"`
+	MeanGrade       float64              `json:"meanGrade,omitempty"`
+	Prompt          string               `json:"prompt"` // answer template version used for graded answers
+	Results         []EvalQuestionResult `json:"results"`
+}
+
+// LoadGoldenSet reads a golden question set from a .json, .yaml or .yml file.
+func LoadGoldenSet(path string) (*GoldenSet, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var set GoldenSet
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(raw, &set)
+	default:
+		err = json.Unmarshal(raw, &set)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid golden set %s: %w", path, err)
+	}
+	if set.Name == "" {
+		set.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	for i, q := range set.Questions {
+		if strings.TrimSpace(q.Question) == "" || len(q.ExpectedSources) == 0 {
+			return nil, fmt.Errorf("golden question %d needs a question and at least one expected source", i+1)
+		}
+		if q.ID == "" {
+			set.Questions[i].ID = strconv.Itoa(i + 1)
+		}
+		if q.Category == "" {
+			// Default to the category of the first expected source ("db/...", "resume/...", "github/...")
+			set.Questions[i].Category = strings.SplitN(q.ExpectedSources[0], "/", 2)[0]
+		}
+	}
+	return &set, nil
+}
+
+// BuildIndexFromSnapshots chunks the db-context.json, github-context.json and resume-context.json
+// files found in dir and embeds them with the configured embedder into an in-memory index.
+// Missing files are treated as empty snapshots.
+func BuildIndexFromSnapshots(ctx context.Context, dir string) ([]MemoryItem, error) {
+	chunks, err := loadSnapshotChunks(dir)
+	if err != nil {
+		return nil, err
+	}
+	embedder := configuredEmbedder()
+	fitEmbedder(embedder, chunks)
+	index := make([]MemoryItem, 0, len(chunks))
+	for _, chunk := range chunks {
+		if strings.TrimSpace(chunk.Text) == "" {
+			continue
+		}
+		emb, err := embedder.Embed(ctx, chunk.Text)
+		if err != nil {
+			return nil, fmt.Errorf("embed %s: %w", chunk.Source, err)
+		}
+		chunk.setEmbedding(emb)
+		index = append(index, chunk)
+	}
+	if len(index) == 0 {
+		return nil, fmt.Errorf("no snapshot chunks found in %s", dir)
+	}
+	return index, nil
+}
+
+// loadSnapshotChunks chunks the snapshot files found in dir.
+func loadSnapshotChunks(dir string) ([]MemoryItem, error) {
+	read := func(name string) (string, error) {
+		raw, err := os.ReadFile(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return string(raw), err
+	}
+	dbJSON, err := read("db-context.json")
+	if err != nil {
+		return nil, err
+	}
+	ghJSON, err := read("github-context.json")
+	if err != nil {
+		return nil, err
+	}
+	resJSON, err := read("resume-context.json")
+	if err != nil {
+		return nil, err
+	}
+	return chunkContextSnapshots(dbJSON, ghJSON, resJSON), nil
+}
+
+// CurrentMemoryIndex loads the active memory index version from the AI DB. It only reads:
+// nothing is built, saved or migrated, so evaluating never touches the live index. The selected
+// embedder must be the one the version was embedded with, or query vectors can't be compared.
+func CurrentMemoryIndex(ctx context.Context) ([]MemoryItem, error) {
+	meta, err := loadMemoryIndexMeta(ctx)
+	if err != nil {
+		return nil, err
+	}
+	embedder := configuredEmbedder()
+	if meta.Embedder != embedder.Name() {
+		return nil, fmt.Errorf("stored memory index version %q was embedded with %q, not the selected %q", meta.Version, meta.Embedder, embedder.Name())
+	}
+	if ce, ok := embedder.(corpusEmbedder); ok {
+		if err := ce.Restore(meta.EmbedderState); err != nil {
+			return nil, fmt.Errorf("stored memory index embedder state unusable: %w", err)
+		}
+	}
+	index, err := loadStoredIndex(ctx, meta.Version)
+	if err != nil {
+		return nil, err
+	}
+	if len(index) == 0 {
+		return nil, fmt.Errorf("no memory index stored for version %q", meta.Version)
+	}
+	return index, nil
+}
+
+// RunRetrievalEval runs every golden question through the askLLM retrieval path against index
+// and reports recall@k, MRR and per-category hit rates. Ranks are positions in the selected
+// context, i.e. the order in which chunks are handed to the chat model.
+func RunRetrievalEval(ctx context.Context, set *GoldenSet, index []MemoryItem, opts EvalOptions) (*EvalReport, error) {
+	if opts.K <= 0 {
+		opts.K = 5
+	}
+	if opts.Profile == nil {
+		opts.Profile = currentRetrievalProfile()
+	}
+	report := &EvalReport{
+		Set:             set.Name,
+		Provider:        aiProvider.Name(),
+		Embedder:        activeEmbedder().Name(),
+		Profile:         opts.Profile.Name,
+		Prompt:          activePrompt(promptAnswer).Ref(),
+		IndexSize:       len(index),
+		K:               opts.K,
+		Questions:       len(set.Questions),
+		CategoryHitRate: map[string]float64{},
+	}
+	categoryTotals := map[string]int{}
+	var recallSum, rrSum, gradeSum float64
+	for _, q := range set.Questions {
+		qEmb, err := activeEmbedder().Embed(ctx, q.Question)
+		if err != nil {
+			return nil, fmt.Errorf("embed question %s: %w", q.ID, err)
+		}
+		selected := retrieveContext(q.Question, qEmb, index, opts.Profile, nil)
+		res := EvalQuestionResult{ID: q.ID, Question: q.Question, Category: q.Category}
+		for _, item := range selected {
+			res.Retrieved = append(res.Retrieved, item.Source)
+		}
+		found := 0
+		for _, want := range q.ExpectedSources {
+			rank := sourceRank(res.Retrieved, want)
+			if rank > 0 && rank <= opts.K {
+				found++
+				if rr := 1 / float64(rank); rr > res.ReciprocalRank {
+					res.ReciprocalRank = rr
+				}
+			} else {
+				res.Missed = append(res.Missed, want)
+			}
+		}
+		res.Recall = float64(found) / float64(len(q.ExpectedSources))
+		recallSum += res.Recall
+		rrSum += res.ReciprocalRank
+		categoryTotals[q.Category]++
+		if found > 0 {
+			report.CategoryHitRate[q.Category]++
+		}
+		if opts.Grade && q.ExpectedAnswer != "" {
+			answer, grade, note := gradeAnswer(ctx, q, selected)
+			res.Answer = answer
+			res.GradeNote = note
+			if note == "" {
+				res.Grade = &grade
+				gradeSum += grade
+				report.Graded++
+			}
+		}
+		report.Results = append(report.Results, res)
+	}
+	if n := len(set.Questions); n > 0 {
+		report.RecallAtK = recallSum / float64(n)
+		report.MRR = rrSum / float64(n)
+	}
+	for cat, total := range categoryTotals {
+		report.CategoryHitRate[cat] /= float64(total)
+	}
+	if report.Graded > 0 {
+		report.MeanGrade = gradeSum / float64(report.Graded)
+	}
+	return report, nil
+}
+
+// sourceRank returns the 1-based position of want in retrieved (case-insensitive), or 0 if absent.
+func sourceRank(retrieved []string, want string) int {
+	for i, src := range retrieved {
+		if strings.EqualFold(strings.TrimSpace(src), strings.TrimSpace(want)) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// gradeAnswer generates an answer from the selected chunks and asks the provider to score it
+// against the expected answer on a 0-1 scale. A non-empty note means the answer was not graded.
+func gradeAnswer(ctx context.Context, q GoldenQuestion, selected []MemoryItem) (string, float64, string) {
+	result, err := generateAnswer(ctx, q.Question, "", selected)
+	if err != nil {
+		return "", 0, "answer failed: " + err.Error()
+	}
+	answer := result.Answer
+	systemPrompt := `You grade a chatbot answer against a reference answer.
+Reply with a single number between 0 and 1: 1 if the answer is fully correct and consistent with the reference, 0 if it is wrong or missing.`
+	userPrompt := fmt.Sprintf("QUESTION: %s\nREFERENCE: %s\nANSWER: %s", q.Question, q.ExpectedAnswer, answer)
+	out, _, err := completeTask(ctx, taskGrade, openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{
+			{Role: "system", Content: systemPrompt},
+			{Role: "user", Content: userPrompt},
+		},
+	})
+	if err != nil {
+		return answer, 0, "grading failed: " + err.Error()
+	}
+	fields := strings.Fields(out)
+	if len(fields) == 0 {
+		return answer, 0, "grader returned no score"
+	}
+	grade, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return answer, 0, fmt.Sprintf("grader returned %q", out)
+	}
+	if grade < 0 {
+		grade = 0
+	} else if grade > 1 {
+		grade = 1
+	}
+	return answer, grade, ""
+}
+
+// FormatEvalReport renders a report as a human-readable table.
+func FormatEvalReport(r *EvalReport) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Golden set: %s | Provider: %s | Embedder: %s | Profile: %s | Index: %d chunks | Questions: %d\n", r.Set, r.Provider, r.Embedder, r.Profile, r.IndexSize, r.Questions)
+	fmt.Fprintf(&b, "Recall@%d: %.3f | MRR: %.3f", r.K, r.RecallAtK, r.MRR)
+	if r.Graded > 0 {
+		fmt.Fprintf(&b, " | Mean grade: %.3f (%d graded, %s)", r.MeanGrade, r.Graded, r.Prompt)
+	}
+	b.WriteString("\n\nCategory hit rates:\n")
+	cats := make([]string, 0, len(r.CategoryHitRate))
+	for cat := range r.CategoryHitRate {
+		cats = append(cats, cat)
+	}
+	sort.Strings(cats)
+	for _, cat := range cats {
+		fmt.Fprintf(&b, "  %-10s %.3f\n", cat, r.CategoryHitRate[cat])
+	}
+	b.WriteString("\n")
+	tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tCategory\tRecall\tRR\tMissed")
+	for _, res := range r.Results {
+		fmt.Fprintf(tw, "%s\t%s\t%.2f\t%.2f\t%s\n", res.ID, res.Category, res.Recall, res.ReciprocalRank, strings.Join(res.Missed, ", "))
+	}
+	tw.Flush()
+	return b.String()
+}
@@ -0,0 +1,207 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Degraded-mode settings
+const (
+	fallbackTopChunks    = 4 // chunks sentences are drawn from
+	fallbackMaxSentences = 3
+	bm25K1               = 1.2
+	bm25B                = 0.75
+)
+
+// Explanation shown with degraded answers that found no passages
+const fallbackNoticeEmpty = "The AI assistant is temporarily unavailable and no matching passages were found. Please try again in a moment."
+
+// fallbackNoticeChat is the explanation shown with degraded answers built from passages.
+func fallbackNoticeChat() string {
+	return fmt.Sprintf("The AI assistant is temporarily unavailable, so here are the most relevant passages from %s portfolio.", currentPersona().possessiveName())
+}
+
+// lexicalIndex is a BM25 index over the chunk texts, used when embeddings are unavailable.
+type lexicalIndex struct {
+	items     []MemoryItem
+	termFreqs []map[string]int
+	lengths   []int
+	docFreq   map[string]int
+	avgLength float64
+	signature string
+}
+
+// Lexical index cache, rebuilt when the memory index changes
+var lexicalState = struct {
+	sync.Mutex
+	index *lexicalIndex
+}{}
+
+// newLexicalIndex tokenizes every chunk of items.
+func newLexicalIndex(items []MemoryItem, signature string) *lexicalIndex {
+	idx := &lexicalIndex{items: items, docFreq: map[string]int{}, signature: signature}
+	var total int
+	for _, item := range items {
+		tf := map[string]int{}
+		tokens := tokenize(item.Text)
+		for _, tok := range tokens {
+			tf[tok]++
+		}
+		for tok := range tf {
+			idx.docFreq[tok]++
+		}
+		idx.termFreqs = append(idx.termFreqs, tf)
+		idx.lengths = append(idx.lengths, len(tokens))
+		total += len(tokens)
+	}
+	if len(items) > 0 {
+		idx.avgLength = float64(total) / float64(len(items))
+	}
+	return idx
+}
+
+// currentLexicalIndex returns the lexical index over the memory index, or over freshly chunked
+// snapshots when the memory index could not be built (e.g. the embedding API is down).
+func currentLexicalIndex(ctx context.Context) (*lexicalIndex, error) {
+	idx := currentIndex()
+	items := idx.Items
+	signature := lexicalSignature(idx.Meta.LastUpdate, items)
+	lexicalState.Lock()
+	defer lexicalState.Unlock()
+	if lexicalState.index != nil && (lexicalState.index.signature == signature || len(items) == 0) {
+		return lexicalState.index, nil
+	}
+	if len(items) == 0 {
+		chunks, err := loadAndChunkData(ctx)
+		if err != nil {
+			return nil, err
+		}
+		items, signature = chunks, "snapshots"
+	}
+	lexicalState.index = newLexicalIndex(items, signature)
+	return lexicalState.index, nil
+}
+
+// lexicalSignature identifies the memory index a lexical index was built from.
+func lexicalSignature(lastUpdate string, items []MemoryItem) string {
+	return fmt.Sprintf("memory:%s:%d", lastUpdate, len(items))
+}
+
+// idf is the BM25 inverse document frequency of a term.
+func (idx *lexicalIndex) idf(term string) float64 {
+	n := float64(len(idx.items))
+	df := float64(idx.docFreq[term])
+	return math.Log(1 + (n-df+0.5)/(df+0.5))
+}
+
+// search returns the k chunks with the best BM25 score for query.
+func (idx *lexicalIndex) search(query string, k int) []MemoryItem {
+	terms := tokenSet(query)
+	type scored struct {
+		i     int
+		score float64
+	}
+	var results []scored
+	for i, tf := range idx.termFreqs {
+		var score float64
+		for term := range terms {
+			f := float64(tf[term])
+			if f == 0 {
+				continue
+			}
+			norm := 1 - bm25B + bm25B*float64(idx.lengths[i])/idx.avgLength
+			score += idx.idf(term) * f * (bm25K1 + 1) / (f + bm25K1*norm)
+		}
+		if score > 0 {
+			results = append(results, scored{i, score})
+		}
+	}
+	sort.SliceStable(results, func(a, b int) bool { return results[a].score > results[b].score })
+	var out []MemoryItem
+	for _, r := range results {
+		if len(out) == k {
+			break
+		}
+		out = append(out, idx.items[r.i])
+	}
+	return out
+}
+
+// sentencePattern splits chunk text into sentences and lines; a period only ends a sentence
+// before whitespace, so "4.5" stays whole.
+var sentencePattern = regexp.MustCompile(`(?m)[^\n]+?([.!?]+(\s|$)|$)`)
+
+// extractiveAnswer builds an answer from the sentences of the top chunks that best match the
+// query, each followed by its source. It returns the answer and the sources it quotes.
+func extractiveAnswer(query string, chunks []MemoryItem, idx *lexicalIndex) (string, []string) {
+	if len(chunks) > fallbackTopChunks {
+		chunks = chunks[:fallbackTopChunks]
+	}
+	terms := tokenSet(query)
+	type candidate struct {
+		text, source string
+		score        float64
+	}
+	var candidates []candidate
+	for rank, chunk := range chunks {
+		for _, sentence := range sentencePattern.FindAllString(chunk.Text, -1) {
+			sentence = strings.Join(strings.Fields(sentence), " ")
+			if len(sentence) < 25 {
+				continue
+			}
+			var score float64
+			words := tokenSet(sentence)
+			for term := range terms {
+				if words[term] {
+					score += idx.idf(term)
+				}
+			}
+			// Prefer sentences from higher-ranked chunks, and don't let long sentences win on length
+			score = score/math.Sqrt(float64(len(words))+1) + 0.05/float64(rank+1)
+			candidates = append(candidates, candidate{sentence, chunk.Source, score})
+		}
+	}
+	sort.SliceStable(candidates, func(a, b int) bool { return candidates[a].score > candidates[b].score })
+	var lines, sources []string
+	seen := map[string]bool{}
+	for _, c := range candidates {
+		if len(lines) == fallbackMaxSentences {
+			break
+		}
+		if seen[c.text] {
+			continue
+		}
+		seen[c.text] = true
+		lines = append(lines, fmt.Sprintf("- %s (%s)", c.text, c.source))
+		if !containsString(sources, c.source) {
+			sources = append(sources, c.source)
+		}
+	}
+	return strings.Join(lines, "\n"), sources
+}
+
+// degradedAnswer answers from chunks without the chat model. When chunks is nil (no query
+// embedding) they are retrieved lexically. cause is logged, never shown to the visitor.
+func degradedAnswer(query string, chunks []MemoryItem, cause error) (*AskResult, error) {
+	log.Printf("⚠️ Answering %q in degraded mode: %v", query, cause)
+	idx, err := currentLexicalIndex(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("%v; lexical fallback unavailable: %w", cause, err)
+	}
+	if chunks == nil {
+		chunks = guardContext(idx.search(query, fallbackTopChunks))
+	}
+	answer, sources := extractiveAnswer(query, chunks, idx)
+	if answer == "" {
+		return &AskResult{Answer: fallbackNoticeEmpty, Sources: []string{}, Degraded: true, Notice: fallbackNoticeEmpty}, nil
+	}
+	// The notice leads the answer too, for clients that only render the answer text
+	notice := fallbackNoticeChat()
+	return &AskResult{Answer: notice + "\n\n" + answer, Sources: sources, Degraded: true, Notice: notice}, nil
+}
@@ -0,0 +1,243 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"example.com/portfolio-backend/config"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Feedback ratings run from 1 to 5; thumbs-up/down widgets send 5 and 1. Ratings up to
+// lowRatingMax count as low and are the golden set candidates.
+const (
+	minRating    = 1
+	maxRating    = 5
+	lowRatingMax = 2
+)
+
+// maxFeedbackComment bounds the visitor's comment.
+const maxFeedbackComment = 1000
+
+// answerTraceRetention is how long answer traces, and the feedback on them, are kept.
+const answerTraceRetention = 90 * 24 * time.Hour
+
+// AnswerTrace is everything that went into one answer, stored in the "answerTraces" collection
+// of the AI DB under the answer ID returned to the visitor, with the visitor's text and the
+// answer redacted. Traces expire after answerTraceRetention.
+type AnswerTrace struct {
+	ID             string          `bson:"_id" json:"id"`
+	Query          string          `bson:"query" json:"query"`                   // as the visitor typed it
+	RewrittenQuery string          `bson:"rewrittenQuery" json:"rewrittenQuery"` // as retrieval saw it, when optimize-query rewrote it
+	Memory         string          `bson:"memory,omitempty" json:"memory,omitempty"`
+	Mode           string          `bson:"mode" json:"mode"`
+	Answer         string          `bson:"answer" json:"answer"`
+	Sources        []string        `bson:"sources" json:"sources"`                   // IDs of the chunks the answer was grounded on
+	Prompt         string          `bson:"prompt,omitempty" json:"prompt,omitempty"` // prompt template version, e.g. "answer@v2"
+	Model          string          `bson:"model,omitempty" json:"model,omitempty"`
+	Cached         bool            `bson:"cached" json:"cached"`
+	Degraded       bool            `bson:"degraded" json:"degraded"`
+	Refused        bool            `bson:"refused" json:"refused"`
+	CreatedAt      time.Time       `bson:"createdAt" json:"createdAt"`
+	Feedback       *AnswerFeedback `bson:"feedback,omitempty" json:"feedback,omitempty"`
+}
+
+// AnswerFeedback is a visitor's rating of an answer; a later rating replaces it.
+type AnswerFeedback struct {
+	Rating    int       `bson:"rating" json:"rating"`
+	Comment   string    `bson:"comment,omitempty" json:"comment,omitempty"`
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+}
+
+// originalQueryKey is the context key of the visitor's query before optimize-query rewrote it.
+type originalQueryKey struct{}
+
+// WithOriginalQuery returns ctx carrying the query the visitor typed, when the one passed to
+// AskLLM is the optimized rewrite, so the answer trace keeps both.
+func WithOriginalQuery(ctx context.Context, query string) context.Context {
+	if strings.TrimSpace(query) == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, originalQueryKey{}, strings.TrimSpace(query))
+}
+
+// recordAnswerTrace stores the trace of an answer and gives the answer its ID. The trace is
+// saved before the answer is returned, so feedback on the ID always finds it; answers whose
+// trace couldn't be saved get no ID. Visitor text is redacted with the active policy first.
+func recordAnswerTrace(ctx context.Context, query, memory, mode string, result *AskResult) {
+	if config.AIDB == nil {
+		return
+	}
+	if mode == "" {
+		mode = AnswerModeRAG
+	}
+	trace := AnswerTrace{
+		ID:        primitive.NewObjectID().Hex(),
+		Query:     strings.TrimSpace(query),
+		Memory:    memory,
+		Mode:      mode,
+		Answer:    result.Answer,
+		Sources:   result.Sources,
+		Prompt:    result.Prompt,
+		Model:     result.Model,
+		Cached:    result.Cached,
+		Degraded:  result.Degraded,
+		Refused:   result.Refused,
+		CreatedAt: time.Now(),
+	}
+	if original, ok := ctx.Value(originalQueryKey{}).(string); ok && original != trace.Query {
+		trace.Query, trace.RewrittenQuery = original, trace.Query
+	}
+	// The answer can repeat what the visitor wrote, so it is redacted too
+	policy, report := currentRedactionPolicy(), newRedactionReport()
+	for _, text := range []*string{&trace.Query, &trace.RewrittenQuery, &trace.Memory, &trace.Answer} {
+		*text = policy.redactText(*text, report)
+	}
+	coll := config.GetDBAI().Collection("answerTraces")
+	// The visitor may leave as soon as the answer is ready; the trace is saved regardless
+	saveCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ensureAnswerTraceIndex.Do(func() {
+		_, err := coll.CreateIndex(saveCtx, mongo.IndexModel{
+			Keys:    bson.M{"createdAt": 1},
+			Options: options.Index().SetExpireAfterSeconds(int32(answerTraceRetention.Seconds())),
+		})
+		if err != nil {
+			log.Println("Error creating answer trace expiry index:", err)
+		}
+	})
+	if _, err := coll.InsertOne(saveCtx, trace); err != nil {
+		log.Println("Error saving answer trace:", err)
+		return
+	}
+	result.ID = trace.ID
+}
+
+// ensureAnswerTraceIndex creates the answer trace TTL index on the first save.
+var ensureAnswerTraceIndex sync.Once
+
+// -- Handlers --
+
+// PostFeedback records a visitor's rating (1-5) and optional comment for an answer ID.
+func PostFeedback(c *gin.Context) {
+	var req struct {
+		AnswerID string `json:"answerId"`
+		Rating   int    `json:"rating"`
+		Comment  string `json:"comment"`
+	}
+	if err := c.BindJSON(&req); err != nil || req.AnswerID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Answer ID is required"})
+		return
+	}
+	if req.Rating < minRating || req.Rating > maxRating {
+		c.JSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("Rating must be between %d and %d", minRating, maxRating)})
+		return
+	}
+	comment := strings.TrimSpace(req.Comment)
+	if utf8.RuneCountInString(comment) > maxFeedbackComment {
+		c.JSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("Comment must be at most %d characters", maxFeedbackComment)})
+		return
+	}
+	// Stored with the trace, so it is redacted like the visitor's query
+	comment = currentRedactionPolicy().redactText(comment, newRedactionReport())
+	res, err := config.GetDBAI().Collection("answerTraces").UpdateOne(c.Request.Context(),
+		bson.M{"_id": req.AnswerID},
+		bson.M{"$set": bson.M{"feedback": AnswerFeedback{Rating: req.Rating, Comment: comment, CreatedAt: time.Now()}}},
+	)
+	if err != nil {
+		log.Println("Error saving answer feedback:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving feedback"})
+		return
+	}
+	if res.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Answer not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Thanks for your feedback!"})
+}
+
+// lowRatedTraces loads the traces rated at most maxRating, newest feedback first.
+func lowRatedTraces(ctx context.Context, maxRating int, limit int64) ([]AnswerTrace, error) {
+	opts := options.Find().SetSort(bson.M{"feedback.createdAt": -1})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+	cursor, err := config.GetDBAI().Collection("answerTraces").Find(ctx, bson.M{"feedback.rating": bson.M{"$lte": maxRating}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	traces := []AnswerTrace{}
+	if err := cursor.All(ctx, &traces); err != nil {
+		return nil, err
+	}
+	return traces, nil
+}
+
+// queryInt reads an integer query parameter, falling back to def when it is missing or invalid.
+func queryInt(c *gin.Context, name string, def int) int {
+	if v, err := strconv.Atoi(c.Query(name)); err == nil {
+		return v
+	}
+	return def
+}
+
+// GetLowRatedAnswers lists answers rated at most maxRating (default 2) with their full trace.
+// Query parameters: maxRating and limit (default 50).
+func GetLowRatedAnswers(c *gin.Context) {
+	traces, err := lowRatedTraces(c.Request.Context(), queryInt(c, "maxRating", lowRatingMax), int64(queryInt(c, "limit", 50)))
+	if err != nil {
+		log.Println("Error loading low-rated answers:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error loading low-rated answers"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"answers": traces, "count": len(traces)})
+}
+
+// ExportFeedbackGoldenSet returns the thumbs-down answers as a golden set of candidate eval
+// questions. Expected sources start as the chunks the bad answer used and the note carries
+// the answer and comment; both need review before the cases join the golden set.
+func ExportFeedbackGoldenSet(c *gin.Context) {
+	traces, err := lowRatedTraces(c.Request.Context(), queryInt(c, "maxRating", lowRatingMax), 0)
+	if err != nil {
+		log.Println("Error loading low-rated answers:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error loading low-rated answers"})
+		return
+	}
+	set := GoldenSet{Name: "feedback-candidates-" + time.Now().Format("2006-01-02"), Questions: []GoldenQuestion{}}
+	seen := map[string]bool{}
+	for _, t := range traces {
+		// Retrieval ran on the rewritten query, which is also self-contained
+		question := t.Query
+		if t.RewrittenQuery != "" {
+			question = t.RewrittenQuery
+		}
+		key := strings.ToLower(question)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		note := fmt.Sprintf("Rated %d/%d. Answer: %q", t.Feedback.Rating, maxRating, t.Answer)
+		if t.Feedback.Comment != "" {
+			note += fmt.Sprintf(" Comment: %q", t.Feedback.Comment)
+		}
+		set.Questions = append(set.Questions, GoldenQuestion{
+			ID:              "feedback-" + t.ID,
+			Question:        question,
+			ExpectedSources: t.Sources,
+			Note:            note,
+		})
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", set.Name+".json"))
+	c.JSON(http.StatusOK, set)
+}
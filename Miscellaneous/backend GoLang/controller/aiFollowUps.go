@@ -0,0 +1,228 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+
+	"example.com/portfolio-backend/config"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Follow-up suggestion settings
+const (
+	followUpCount      = 3 // suggestions returned
+	followUpCandidates = 6 // candidates requested from the model before filtering
+)
+
+// A suggestion counts as answerable when its best-chunk similarity reaches followUpMinSimilarity.
+// That cut-off is calibrated for OpenAI embeddings; other embedders (local TF-IDF, fake) put
+// cosines on another scale, so there a suggestion needs followUpMinRelative times the best
+// candidate's similarity, and at least the embedder family's floor in followUpFloors so an
+// ungrounded best candidate doesn't pass on its own.
+var (
+	followUpMinSimilarity = config.EnvFloat("AI_FOLLOWUP_MIN_SIMILARITY", 0.4)
+	followUpMinRelative   = config.EnvFloat("AI_FOLLOWUP_MIN_RELATIVE", 0.8)
+	// Measured on the bundled eval data, on-topic questions score from 0.062 (local) and
+	// 0.164 (fake) against their best chunk
+	followUpFloors = map[string]float64{"local": 0.06, "fake": 0.15}
+)
+
+// followUpThreshold returns the grounding cut-off for suggestions embedded with e, given the
+// best-chunk similarities of all candidates.
+func followUpThreshold(e Embedder, sims []float64) float64 {
+	floor, ok := followUpFloors[embedderFamily(e)]
+	if !ok {
+		return followUpMinSimilarity
+	}
+	best := -1.0
+	for _, sim := range sims {
+		best = math.Max(best, sim)
+	}
+	return math.Max(floor, best*followUpMinRelative)
+}
+
+// followUpSchema is the JSON schema the chat model must follow for suggestions.
+var followUpSchema = json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"questions": {"type": "array", "items": {"type": "string"}}
+	},
+	"required": ["questions"],
+	"additionalProperties": false
+}`)
+
+// suggestFollowUpQuestions asks the chat model for candidate follow-up questions (as structured
+// JSON), drops those already asked in the session and keeps only the ones whose embedding
+// retrieves at least one strong chunk, so every suggestion can actually be answered.
+func suggestFollowUpQuestions(ctx context.Context, query string, response string, conversationMemory string, askedQuestions []string) ([]string, string, error) {
+	if strings.TrimSpace(query) == "" || strings.TrimSpace(response) == "" {
+		return nil, "", fmt.Errorf("Both query and response are required")
+	}
+	ensureMemoryIndex()
+	idx := currentIndex()
+	asked := append([]string{query}, askedQuestions...)
+	candidates, prompt, err := generateFollowUpCandidates(ctx, query, response, conversationMemory, asked)
+	if err != nil {
+		return nil, prompt, err
+	}
+	policy, extra := currentGuardrailPolicy()
+	type candidate struct {
+		question string
+		emb      []float32
+		sim      float64
+	}
+	var scored []candidate
+	var sims []float64
+	for _, cand := range candidates {
+		if isAskedQuestion(cand, asked) {
+			continue
+		}
+		if _, found := detectInjection(cand, false, extra); found && policy.Enabled {
+			continue
+		}
+		emb, err := idx.embed(ctx, cand)
+		if err != nil {
+			return nil, prompt, fmt.Errorf("failed to embed follow-up: %w", err)
+		}
+		sim := bestChunkSimilarity(emb, idx.Items)
+		scored = append(scored, candidate{cand, emb, sim})
+		sims = append(sims, sim)
+	}
+	threshold := followUpThreshold(idx.embedder(), sims)
+	suggestions := []string{}
+	var kept [][]float32
+	for _, cand := range scored {
+		if len(suggestions) == followUpCount {
+			break
+		}
+		// Near-duplicates of an already kept suggestion
+		duplicate := false
+		for _, prev := range kept {
+			if cosineSimilarity(cand.emb, vectorNorm(cand.emb), prev) >= 0.95 {
+				duplicate = true
+				break
+			}
+		}
+		if duplicate {
+			continue
+		}
+		if cand.sim < threshold {
+			log.Printf("Dropped ungrounded follow-up %q (best chunk %.3f < %.3f)", cand.question, cand.sim, threshold)
+			continue
+		}
+		suggestions = append(suggestions, cand.question)
+		kept = append(kept, cand.emb)
+	}
+	return suggestions, prompt, nil
+}
+
+// SuggestFollowUpQuestions suggests up to three answerable follow-up questions for the last
+// exchange and returns the prompt template version used.
+func SuggestFollowUpQuestions(ctx context.Context, query string, response string, conversationMemory string, askedQuestions []string) ([]string, string, error) {
+	return suggestFollowUpQuestions(ctx, query, response, conversationMemory, askedQuestions)
+}
+
+// generateFollowUpCandidates requests candidate questions from the chat model as structured output
+// and returns them with the prompt template version used.
+func generateFollowUpCandidates(ctx context.Context, query, response, conversationMemory string, asked []string) ([]string, string, error) {
+	prompt, err := renderPrompt(promptFollowUps, promptData{
+		Memory: parseConversationMemory(conversationMemory).promptText(),
+		Asked:  asked,
+		Query:  query,
+		Answer: response,
+		Count:  followUpCandidates,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	raw, _, err := completeTask(ctx, taskFollowUps, openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: prompt.System},
+			{Role: openai.ChatMessageRoleUser, Content: prompt.User},
+		},
+		ResponseFormat: &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+			JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+				Name:   "follow_up_questions",
+				Schema: followUpSchema,
+				Strict: true,
+			},
+		},
+	})
+	if err != nil {
+		return nil, prompt.Ref, err
+	}
+	var out struct {
+		Questions []string `json:"questions"`
+	}
+	if err := json.Unmarshal([]byte(raw), &out); err != nil {
+		return nil, prompt.Ref, fmt.Errorf("invalid follow-up output: %w", err)
+	}
+	var questions []string
+	for _, q := range out.Questions {
+		if q = strings.TrimSpace(q); q != "" {
+			questions = append(questions, q)
+		}
+	}
+	return questions, prompt.Ref, nil
+}
+
+// isAskedQuestion reports whether question is (nearly) the same as one already asked, by token
+// overlap so rephrasings like "What are his skills?" / "what skills does he have" match.
+func isAskedQuestion(question string, asked []string) bool {
+	tokens := tokenSet(question)
+	for _, a := range asked {
+		other := tokenSet(a)
+		if len(tokens) == 0 || len(other) == 0 {
+			continue
+		}
+		shared := 0
+		for t := range tokens {
+			if other[t] {
+				shared++
+			}
+		}
+		if float64(shared)/float64(len(tokens)+len(other)-shared) >= 0.6 {
+			return true
+		}
+	}
+	return false
+}
+
+// followUpStopwords are ignored when comparing questions, along with the owner's short name
+// and pronouns (personaStopwords).
+var followUpStopwords = map[string]bool{
+	"what": true, "which": true, "how": true, "does": true, "did": true, "do": true, "is": true,
+	"are": true, "was": true, "the": true, "a": true, "an": true, "of": true, "in": true,
+	"on": true, "to": true, "about": true, "me": true, "tell": true, "can": true, "you": true,
+	"have": true, "has": true,
+}
+
+// personaStopwords returns the words of the owner's short name and pronouns, which nearly
+// every question contains.
+func personaStopwords() map[string]bool {
+	p := currentPersona()
+	words := map[string]bool{}
+	for _, text := range []string{p.ShortName, p.Pronouns.Subject, p.Pronouns.Object, p.Pronouns.Possessive} {
+		for _, tok := range tokenize(text) {
+			words[tok] = true
+		}
+	}
+	return words
+}
+
+// tokenSet returns the content words of text.
+func tokenSet(text string) map[string]bool {
+	owner := personaStopwords()
+	set := map[string]bool{}
+	for _, tok := range tokenize(text) {
+		if !followUpStopwords[tok] && !owner[tok] {
+			set[tok] = true
+		}
+	}
+	return set
+}
@@ -0,0 +1,348 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/portfolio-backend/config"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// GuardrailPolicy configures the chatbot guardrails. It is stored as a single document in the
+// "guardrailPolicy" collection of the AI DB.
+type GuardrailPolicy struct {
+	Enabled            bool               `bson:"enabled" json:"enabled"`
+	BlockInjection     bool               `bson:"blockInjection" json:"blockInjection"`         // refuse queries that look like prompt injection
+	FilterContext      bool               `bson:"filterContext" json:"filterContext"`           // drop retrieved chunks that carry injected instructions
+	RefuseOffTopic     bool               `bson:"refuseOffTopic" json:"refuseOffTopic"`         // refuse queries unrelated to the portfolio
+	OffTopicThreshold  float64            `bson:"offTopicThreshold" json:"offTopicThreshold"`   // minimum similarity to any intent or chunk, for OpenAI embeddings
+	OffTopicThresholds map[string]float64 `bson:"offTopicThresholds" json:"offTopicThresholds"` // per embedder family ("local", "fake"), whose cosines run lower
+	RefusalMessage     string             `bson:"refusalMessage" json:"refusalMessage"`         // reply to blocked injection attempts; empty uses the persona's
+	OffTopicMessage    string             `bson:"offTopicMessage" json:"offTopicMessage"`       // reply to off-topic queries; empty uses the persona's
+	ExtraPatterns      []string           `bson:"extraPatterns" json:"extraPatterns"`           // additional case-insensitive regexes
+	UpdatedAt          time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
+
+// defaultGuardrailPolicy returns the built-in policy used until one is stored. Its messages are
+// left empty so they follow the persona.
+func defaultGuardrailPolicy() *GuardrailPolicy {
+	return &GuardrailPolicy{
+		Enabled:           true,
+		BlockInjection:    true,
+		FilterContext:     true,
+		RefuseOffTopic:    true,
+		OffTopicThreshold: 0.2,
+		// Measured on the bundled eval data: on-topic questions score from 0.094 (local) and
+		// 0.275 (fake); the fake embedder hashes tokens and can't tell topics apart
+		OffTopicThresholds: map[string]float64{"local": 0.09, "fake": 0.2},
+	}
+}
+
+// offTopicThreshold returns the off-topic cut-off for queries embedded with e.
+func (p *GuardrailPolicy) offTopicThreshold(e Embedder) float64 {
+	if t, ok := p.OffTopicThresholds[embedderFamily(e)]; ok {
+		return t
+	}
+	return p.OffTopicThreshold
+}
+
+// refusal is the reply to blocked injection attempts.
+func (p *GuardrailPolicy) refusal() string {
+	if strings.TrimSpace(p.RefusalMessage) != "" {
+		return p.RefusalMessage
+	}
+	return currentPersona().refusalMessage()
+}
+
+// offTopic is the reply to off-topic queries.
+func (p *GuardrailPolicy) offTopic() string {
+	if strings.TrimSpace(p.OffTopicMessage) != "" {
+		return p.OffTopicMessage
+	}
+	return currentPersona().offTopicMessage()
+}
+
+// injectionPattern is a named prompt-injection signature. Chunk patterns are also applied to
+// retrieved context; the rest only make sense for visitor queries (a README may legitimately
+// talk about system prompts).
+type injectionPattern struct {
+	Name  string
+	Re    *regexp.Regexp
+	Chunk bool
+}
+
+var injectionPatterns = []injectionPattern{
+	{"ignore-instructions", regexp.MustCompile(`(?i)\b(ignore|disregard|forget)\s+((all|any|every|the|your|these|those|previous|prior|above|earlier|preceding|original|system)\s+)+(instructions|prompts?|rules|guidelines|directions)\b`), true},
+	{"override-instructions", regexp.MustCompile(`(?i)\b(override|bypass|replace)\s+(all\s+|any\s+|the\s+|your\s+)*(instructions|rules|guidelines|restrictions|safety)\b`), true},
+	{"new-instructions", regexp.MustCompile(`(?i)\bnew\s+(instructions|rules|system\s+prompt)\s*:`), true},
+	{"role-tag", regexp.MustCompile(`(?i)(<\|?\s*/?\s*(system|assistant|im_start|im_end)\s*\|?>|\[/?(INST|SYSTEM)\])`), true},
+	{"prompt-delimiter", regexp.MustCompile(`<<<|>>>`), false},
+	{"role-play", regexp.MustCompile(`(?i)\b(you\s+are\s+now|from\s+now\s+on\s+you|pretend\s+(to\s+be|you\s+are)|act\s+as\s+(an?\s+)?(unrestricted|unfiltered|different|new|evil|jailbroken))\b`), true},
+	{"jailbreak", regexp.MustCompile(`(?i)\b(jailbreak|dan\s+mode|developer\s+mode|do\s+anything\s+now)\b`), false},
+	{"prompt-exfiltration", regexp.MustCompile(`(?i)\b(reveal|show|print|repeat|output|leak|tell\s+me)\s+(me\s+)?(your|the)\s+(system\s+|hidden\s+|initial\s+)?(prompt|instructions|rules)\b`), false},
+}
+
+// smallTalk matches greetings and pleasantries, which are answered even though they are not
+// about the portfolio.
+var smallTalk = regexp.MustCompile(`(?i)^\s*(hi|hello|hey|hiya|good\s+(morning|afternoon|evening)|thanks?(\s+you)?|thank\s+you|ok(ay)?|cool|bye|goodbye|who\s+are\s+you|what\s+can\s+you\s+do)\b[\s!.?]*$`)
+
+// Active guardrail policy with its compiled extra patterns
+var guardrailState = struct {
+	sync.RWMutex
+	policy *GuardrailPolicy
+	extra  []*regexp.Regexp
+}{}
+
+// currentGuardrailPolicy returns the active policy and its compiled extra patterns.
+func currentGuardrailPolicy() (*GuardrailPolicy, []*regexp.Regexp) {
+	guardrailState.RLock()
+	defer guardrailState.RUnlock()
+	if guardrailState.policy == nil {
+		return defaultGuardrailPolicy(), nil
+	}
+	return guardrailState.policy, guardrailState.extra
+}
+
+// validate checks the policy and compiles its extra patterns.
+func (p *GuardrailPolicy) validate() ([]*regexp.Regexp, []string) {
+	var errs []string
+	if p.OffTopicThreshold < -1 || p.OffTopicThreshold > 1 {
+		errs = append(errs, "offTopicThreshold must be between -1 and 1")
+	}
+	for family, t := range p.OffTopicThresholds {
+		if t < -1 || t > 1 {
+			errs = append(errs, fmt.Sprintf("offTopicThresholds: %s must be between -1 and 1", family))
+		}
+	}
+	var extra []*regexp.Regexp
+	for _, pat := range p.ExtraPatterns {
+		re, err := regexp.Compile("(?i)" + pat)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("extraPatterns: %q is not a valid regex", pat))
+			continue
+		}
+		extra = append(extra, re)
+	}
+	return extra, errs
+}
+
+// reloadGuardrailPolicy loads the stored policy, keeping the previous one if it is missing or invalid.
+func reloadGuardrailPolicy(ctx context.Context) {
+	p := defaultGuardrailPolicy()
+	err := config.GetDBAI().Collection("guardrailPolicy").FindOne(ctx, bson.M{"_id": "guardrailPolicy"}).Decode(p)
+	if err != nil {
+		return
+	}
+	extra, errs := p.validate()
+	if len(errs) > 0 {
+		log.Printf("Invalid guardrail policy, keeping previous: %s", strings.Join(errs, "; "))
+		return
+	}
+	guardrailState.Lock()
+	guardrailState.policy, guardrailState.extra = p, extra
+	guardrailState.Unlock()
+}
+
+// detectInjection returns the name of the first injection signature found in text. With
+// chunk set only the signatures that apply to retrieved context are checked.
+func detectInjection(text string, chunk bool, extra []*regexp.Regexp) (string, bool) {
+	for _, pat := range injectionPatterns {
+		if chunk && !pat.Chunk {
+			continue
+		}
+		if pat.Re.MatchString(text) {
+			return pat.Name, true
+		}
+	}
+	for _, re := range extra {
+		if re.MatchString(text) {
+			return "custom:" + re.String()[len("(?i)"):], true
+		}
+	}
+	return "", false
+}
+
+// guardQuery refuses a query that looks like a prompt-injection attempt.
+func guardQuery(query string) *AskResult {
+	policy, extra := currentGuardrailPolicy()
+	if !policy.Enabled || !policy.BlockInjection {
+		return nil
+	}
+	if reason, found := detectInjection(query, false, extra); found {
+		logGuardrailEvent("injection", reason, query)
+		return &AskResult{Answer: policy.refusal(), Refused: true}
+	}
+	return nil
+}
+
+// guardTopic refuses a query whose embedding is not close to any intent prototype or indexed
+// chunk. Greetings and pleasantries are let through.
+func guardTopic(query string, qEmb []float32, idx *servedIndex) *AskResult {
+	policy, _ := currentGuardrailPolicy()
+	if !policy.Enabled || !policy.RefuseOffTopic || smallTalk.MatchString(query) {
+		return nil
+	}
+	relevance, threshold := topicRelevance(qEmb, idx.Items), policy.offTopicThreshold(idx.embedder())
+	if relevance < threshold {
+		logGuardrailEvent("off-topic", fmt.Sprintf("relevance %.3f < %.3f", relevance, threshold), query)
+		return &AskResult{Answer: policy.offTopic(), Refused: true}
+	}
+	return nil
+}
+
+// topicRelevance is the best cosine similarity between the query and any intent prototype or
+// memory index chunk.
+func topicRelevance(qEmb []float32, index []MemoryItem) float64 {
+	best := bestChunkSimilarity(qEmb, index)
+	if protos, err := intentPrototypeVectors(context.Background()); err == nil {
+		qNorm := vectorNorm(qEmb)
+		for _, vec := range protos {
+			if sim := cosineSimilarity(qEmb, qNorm, vec); sim > best {
+				best = sim
+			}
+		}
+	}
+	return best
+}
+
+// bestChunkSimilarity is the best cosine similarity between the query and any memory index chunk
+// (-1 when nothing is comparable).
+func bestChunkSimilarity(qEmb []float32, index []MemoryItem) float64 {
+	best := -1.0
+	for _, sim := range scoreIndex(qEmb, index) {
+		if !math.IsNaN(sim) && sim > best {
+			best = sim
+		}
+	}
+	return best
+}
+
+// guardContext drops retrieved chunks that carry injected instructions.
+func guardContext(selected []MemoryItem) []MemoryItem {
+	policy, extra := currentGuardrailPolicy()
+	if !policy.Enabled || !policy.FilterContext {
+		return selected
+	}
+	kept := selected[:0:0]
+	for _, item := range selected {
+		if reason, found := detectInjection(item.Text, true, extra); found {
+			logGuardrailEvent("context-injection", reason+" in "+item.Source, item.Text)
+			continue
+		}
+		kept = append(kept, item)
+	}
+	return kept
+}
+
+// guardToolResult screens a tool result like retrieved context: tools read live DB text, which
+// must not smuggle instructions to the model either.
+func guardToolResult(tool, result string) error {
+	policy, extra := currentGuardrailPolicy()
+	if !policy.Enabled || !policy.FilterContext {
+		return nil
+	}
+	if reason, found := detectInjection(result, true, extra); found {
+		logGuardrailEvent("tool-injection", reason+" in "+tool, result)
+		return fmt.Errorf("tool result withheld: it contains instructions")
+	}
+	return nil
+}
+
+// promptDelimiters strips our own delimiter markers from untrusted text before it is placed
+// between them.
+var promptDelimiters = strings.NewReplacer("<<<", "", ">>>", "")
+
+// delimit wraps untrusted text in labelled delimiters for the prompt.
+func delimit(label, text string) string {
+	return fmt.Sprintf("<<<%s>>>\n%s\n<<<END %s>>>", label, promptDelimiters.Replace(text), label)
+}
+
+// Guardrail events waiting for the writer. Refusals happen on unauthenticated requests, so the
+// queue is bounded: when a flood of them fills it, further events are only logged.
+var (
+	guardrailEvents      = make(chan bson.M, 256)
+	startGuardrailWriter sync.Once
+)
+
+// guardrailEventTextMax is the number of runes of the offending text kept with an event.
+const guardrailEventTextMax = 300
+
+// truncateRunes cuts text to at most max runes, marking the cut with an ellipsis.
+func truncateRunes(text string, max int) string {
+	if r := []rune(text); len(r) > max {
+		return string(r[:max]) + "…"
+	}
+	return text
+}
+
+// logGuardrailEvent logs a guardrail trigger and queues it for the AI DB.
+func logGuardrailEvent(kind, reason, text string) {
+	text = truncateRunes(text, guardrailEventTextMax)
+	log.Printf("🛡️ Guardrail %s: %s (%q)", kind, reason, text)
+	if config.AIDB == nil {
+		return
+	}
+	startGuardrailWriter.Do(func() { go writeGuardrailEvents() })
+	select {
+	case guardrailEvents <- bson.M{"kind": kind, "reason": reason, "text": text, "createdAt": time.Now()}:
+	default:
+	}
+}
+
+// writeGuardrailEvents stores queued events one at a time.
+func writeGuardrailEvents() {
+	for event := range guardrailEvents {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		_, err := config.GetDBAI().Collection("guardrailEvents").InsertOne(ctx, event)
+		cancel()
+		if err != nil {
+			log.Println("Error saving guardrail event:", err)
+		}
+	}
+}
+
+// -- Admin handlers --
+
+// GetGuardrailPolicy returns the active guardrail policy.
+func GetGuardrailPolicy(c *gin.Context) {
+	policy, _ := currentGuardrailPolicy()
+	c.JSON(http.StatusOK, policy)
+}
+
+// PutGuardrailPolicy validates, stores and activates a guardrail policy.
+func PutGuardrailPolicy(c *gin.Context) {
+	ctx := c.Request.Context()
+	p := defaultGuardrailPolicy()
+	if err := c.BindJSON(p); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid guardrail policy data"})
+		return
+	}
+	extra, errs := p.validate()
+	if len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid guardrail policy", "errors": errs})
+		return
+	}
+	p.UpdatedAt = time.Now()
+	_, err := config.GetDBAI().Collection("guardrailPolicy").UpdateOne(ctx,
+		bson.M{"_id": "guardrailPolicy"},
+		bson.M{"$set": p},
+		optionsUpsert(),
+	)
+	if err != nil {
+		log.Println("Error saving guardrail policy:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving guardrail policy"})
+		return
+	}
+	guardrailState.Lock()
+	guardrailState.policy, guardrailState.extra = p, extra
+	guardrailState.Unlock()
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Guardrail policy saved.", "policy": p})
+}
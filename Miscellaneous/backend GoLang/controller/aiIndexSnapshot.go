@@ -0,0 +1,161 @@
+package controllers
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/gob"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"example.com/portfolio-backend/config"
+)
+
+// indexSnapshotPath is the local file the memory index is cached in between restarts;
+// "off" disables it.
+var indexSnapshotPath = config.EnvString("AI_INDEX_SNAPSHOT", filepath.Join("data", "cache", "memory-index.snapshot"))
+
+// indexSnapshotFormat is bumped whenever the snapshot layout changes, invalidating old files.
+const indexSnapshotFormat = 1
+
+// indexSnapshot is the on-disk form of the served memory index: the chunks with their int8
+// vectors and norms, and the lexical index used in degraded mode. There is no ANN graph to
+// store; scoring is an exhaustive scan. The fitted embedder state stays in the memoryIndexMeta document.
+type indexSnapshot struct {
+	Format     int
+	Version    string
+	LastUpdate string
+	Embedder   string
+	Dimensions int
+	Exact      bool // items carry float32 vectors for rescoring
+	Items      []MemoryItem
+	Lexical    *lexicalSnapshot
+	SavedAt    time.Time
+}
+
+// lexicalSnapshot is the serialisable part of a lexicalIndex; its items are the snapshot items.
+type lexicalSnapshot struct {
+	TermFreqs []map[string]int
+	Lengths   []int
+	DocFreq   map[string]int
+	AvgLength float64
+	Signature string
+}
+
+// saveIndexSnapshot writes the served index to the snapshot file, replacing it atomically.
+func saveIndexSnapshot(served *servedIndex) {
+	if indexSnapshotPath == "off" || len(served.Items) == 0 {
+		return
+	}
+	snap := indexSnapshot{
+		Format:     indexSnapshotFormat,
+		Version:    served.Meta.Version,
+		LastUpdate: served.Meta.LastUpdate,
+		Embedder:   served.Meta.Embedder,
+		Dimensions: served.Meta.Dimensions,
+		Exact:      vectorRescoreTop > 0,
+		Items:      served.Items,
+		SavedAt:    time.Now(),
+	}
+	idx := newLexicalIndex(served.Items, lexicalSignature(served.Meta.LastUpdate, served.Items))
+	snap.Lexical = &lexicalSnapshot{TermFreqs: idx.termFreqs, Lengths: idx.lengths, DocFreq: idx.docFreq, AvgLength: idx.avgLength, Signature: idx.signature}
+	if err := writeIndexSnapshot(indexSnapshotPath, &snap); err != nil {
+		log.Println("Error saving memory index snapshot:", err)
+		return
+	}
+	log.Printf("💾 Memory index snapshot saved to %s (version %q)", indexSnapshotPath, snap.Version)
+}
+
+// writeIndexSnapshot gzips the gob-encoded snapshot to a temp file and renames it over path.
+func writeIndexSnapshot(path string, snap *indexSnapshot) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	zw := gzip.NewWriter(tmp)
+	if err := gob.NewEncoder(zw).Encode(snap); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// loadIndexSnapshot reads the snapshot file and checks it against the memory index meta and the
+// number of chunks stored for the active version. It returns nil when the file is missing or stale.
+func loadIndexSnapshot(meta indexMeta, count int64) *indexSnapshot {
+	if indexSnapshotPath == "off" {
+		return nil
+	}
+	f, err := os.Open(indexSnapshotPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Println("Error opening memory index snapshot:", err)
+		}
+		return nil
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		log.Println("Error reading memory index snapshot:", err)
+		return nil
+	}
+	var snap indexSnapshot
+	if err := gob.NewDecoder(zr).Decode(&snap); err != nil {
+		log.Println("Error decoding memory index snapshot:", err)
+		return nil
+	}
+	if reason := snap.staleReason(meta, count); reason != "" {
+		log.Printf("Memory index snapshot is stale (%s); loading from DB", reason)
+		return nil
+	}
+	return &snap
+}
+
+// staleReason explains why the snapshot doesn't match the active index, or is empty when it does.
+func (s *indexSnapshot) staleReason(meta indexMeta, count int64) string {
+	switch {
+	case s.Format != indexSnapshotFormat:
+		return fmt.Sprintf("format %d", s.Format)
+	case s.Version != meta.Version:
+		return fmt.Sprintf("version %q, active %q", s.Version, meta.Version)
+	case s.LastUpdate != meta.LastUpdate:
+		return "last update differs"
+	case s.Embedder != meta.Embedder || s.Dimensions != meta.Dimensions:
+		return fmt.Sprintf("embedder %s/%d, active %s/%d", s.Embedder, s.Dimensions, meta.Embedder, meta.Dimensions)
+	case int64(len(s.Items)) != count:
+		return fmt.Sprintf("%d chunks, DB has %d", len(s.Items), count)
+	case s.Exact != (vectorRescoreTop > 0):
+		return "rescoring setting changed"
+	}
+	return ""
+}
+
+// restoreLexicalIndex installs the snapshot's lexical index so degraded mode needs no rebuild.
+func (s *indexSnapshot) restoreLexicalIndex() {
+	if s.Lexical == nil || s.Lexical.Signature != lexicalSignature(s.LastUpdate, s.Items) {
+		return
+	}
+	lexicalState.Lock()
+	lexicalState.index = &lexicalIndex{
+		items:     s.Items,
+		termFreqs: s.Lexical.TermFreqs,
+		lengths:   s.Lexical.Lengths,
+		docFreq:   s.Lexical.DocFreq,
+		avgLength: s.Lexical.AvgLength,
+		signature: s.Lexical.Signature,
+	}
+	lexicalState.Unlock()
+}
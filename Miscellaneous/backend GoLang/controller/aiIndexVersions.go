@@ -0,0 +1,215 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/portfolio-backend/config"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Index version statuses
+const (
+	indexVersionBuilding = "building"
+	indexVersionActive   = "active"
+	indexVersionRetired  = "retired"
+	indexVersionFailed   = "failed"
+)
+
+// IndexVersion records one build of the memory index. Chunks in the "memoryIndex" collection
+// carry the version they belong to; only the active version is served.
+type IndexVersion struct {
+	Version     string     `bson:"_id" json:"version"`
+	Embedder    string     `bson:"embedder" json:"embedder"`
+	Dimensions  int        `bson:"dimensions" json:"dimensions"`
+	Items       int        `bson:"items" json:"items"`
+	Status      string     `bson:"status" json:"status"`
+	Error       string     `bson:"error,omitempty" json:"error,omitempty"`
+	CreatedAt   time.Time  `bson:"createdAt" json:"createdAt"`
+	ActivatedAt *time.Time `bson:"activatedAt,omitempty" json:"activatedAt,omitempty"`
+}
+
+// newIndexVersion returns the ID for an index built at t.
+func newIndexVersion(t time.Time) string {
+	return t.UTC().Format("20060102T150405.000")
+}
+
+// indexVersionFilter selects the chunks of version; indexes saved before versioning have no
+// version field.
+func indexVersionFilter(version string) bson.M {
+	if version == "" {
+		return bson.M{"version": bson.M{"$exists": false}}
+	}
+	return bson.M{"version": version}
+}
+
+// saveIndexVersion upserts the record of an index version.
+func saveIndexVersion(ctx context.Context, v *IndexVersion) {
+	_, err := config.GetDBAI().Collection("memoryIndexVersions").UpdateOne(ctx,
+		bson.M{"_id": v.Version},
+		bson.M{"$set": v},
+		optionsUpsert(),
+	)
+	if err != nil {
+		log.Println("Error saving memory index version:", err)
+	}
+}
+
+// retireIndexVersion marks a replaced version as retired.
+func retireIndexVersion(ctx context.Context, version string) {
+	_, err := config.GetDBAI().Collection("memoryIndexVersions").UpdateOne(ctx,
+		bson.M{"_id": version},
+		bson.M{"$set": bson.M{"status": indexVersionRetired}},
+	)
+	if err != nil {
+		log.Println("Error retiring memory index version:", err)
+	}
+}
+
+// servedIndex is a published memory index: its chunks, their meta and the embedder that
+// produced them, which keeps answering queries while a new version with the configured embedder
+// is built. It is never modified once published; readers take it once per request so the query
+// vector and the chunks always come from the same version.
+type servedIndex struct {
+	Items    []MemoryItem
+	Meta     indexMeta
+	Embedder Embedder // nil before an index is loaded
+}
+
+// The published memory index
+var servedIndexState = struct {
+	sync.RWMutex
+	index *servedIndex
+}{}
+
+// publishIndex makes a loaded or rebuilt index the served one.
+func publishIndex(items []MemoryItem, meta indexMeta, e Embedder) {
+	if p, ok := e.(openAIProvider); ok {
+		e = p.pinned()
+	}
+	servedIndexState.Lock()
+	servedIndexState.index = &servedIndex{Items: items, Meta: meta, Embedder: e}
+	servedIndexState.Unlock()
+}
+
+// currentIndex returns the served index; it is empty before one is loaded.
+func currentIndex() *servedIndex {
+	servedIndexState.RLock()
+	defer servedIndexState.RUnlock()
+	if servedIndexState.index == nil {
+		return &servedIndex{}
+	}
+	return servedIndexState.index
+}
+
+// embedder returns the embedder for queries against the index.
+func (s *servedIndex) embedder() Embedder {
+	if s.Embedder != nil {
+		return s.Embedder
+	}
+	return configuredEmbedder()
+}
+
+// embed embeds a query for scoring against the index.
+func (s *servedIndex) embed(ctx context.Context, text string) ([]float32, error) {
+	return s.embedder().Embed(ctx, text)
+}
+
+// embedderByName recreates the embedder that produced an index from its recorded name and
+// fitted state, so an index from a previous configuration can still be queried.
+func embedderByName(name string, state *EmbedderState) (Embedder, error) {
+	if configured := configuredEmbedder(); configured.Name() == name {
+		return configured, nil
+	}
+	switch {
+	case name == legacyEmbedder:
+		return openAIProvider{embedModel: defaultEmbedModel}, nil
+	case strings.HasPrefix(name, legacyEmbedder+":"):
+		return openAIProvider{embedModel: strings.TrimPrefix(name, legacyEmbedder+":")}, nil
+	case name == (FakeProvider{}).Name():
+		return FakeProvider{}, nil
+	case strings.HasPrefix(name, "local-tfidf-"):
+		dim, err := strconv.Atoi(strings.TrimPrefix(name, "local-tfidf-"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid embedder %q", name)
+		}
+		e := NewLocalEmbedder(dim)
+		if err := e.Restore(state); err != nil {
+			return nil, err
+		}
+		return e, nil
+	}
+	return nil, fmt.Errorf("unknown embedder %q", name)
+}
+
+// Background re-embedding into a new index version
+var indexMigration = struct {
+	sync.Mutex
+	running bool
+}{}
+
+// startIndexMigration re-embeds the index with the configured embedder in the background;
+// the current version keeps serving until the new one is activated. At most one migration runs.
+func startIndexMigration() {
+	indexMigration.Lock()
+	defer indexMigration.Unlock()
+	if indexMigration.running {
+		return
+	}
+	indexMigration.running = true
+	go func() {
+		defer func() {
+			indexMigration.Lock()
+			indexMigration.running = false
+			indexMigration.Unlock()
+		}()
+		log.Printf("🔄 Migrating memory index from %q to %q in the background", currentIndex().Meta.Embedder, configuredEmbedder().Name())
+		if err := buildMemoryIndex(context.Background(), true); err != nil {
+			log.Println("Memory index migration failed:", err)
+		}
+	}()
+}
+
+// indexMigrationRunning reports whether a background re-embed is in progress.
+func indexMigrationRunning() bool {
+	indexMigration.Lock()
+	defer indexMigration.Unlock()
+	return indexMigration.running
+}
+
+// -- Admin handlers --
+
+// GetMemoryIndexVersions lists the memory index versions, newest first, with the active one
+// and whether a migration is running.
+func GetMemoryIndexVersions(c *gin.Context) {
+	cur, err := config.GetDBAI().Collection("memoryIndexVersions").Find(c.Request.Context(), bson.M{},
+		options.Find().SetSort(bson.M{"createdAt": -1}).SetLimit(20))
+	if err != nil {
+		log.Println("Error fetching memory index versions:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching memory index versions"})
+		return
+	}
+	versions := []IndexVersion{}
+	if err := cur.All(c.Request.Context(), &versions); err != nil {
+		log.Println("Error decoding memory index versions:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching memory index versions"})
+		return
+	}
+	meta := currentIndex().Meta
+	c.JSON(http.StatusOK, gin.H{
+		"active":             meta.Version,
+		"embedder":           meta.Embedder,
+		"dimensions":         meta.Dimensions,
+		"configuredEmbedder": configuredEmbedder().Name(),
+		"migrating":          indexMigrationRunning(),
+		"versions":           versions,
+	})
+}
@@ -0,0 +1,290 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// intentSpec describes one query intent: the prototype phrasings used to recognise it and the
+// parts of the memory index it points at.
+type intentSpec struct {
+	Name           string
+	Prototypes     []string
+	Categories     []string // memory index categories that receive the query boost
+	DbLabels       []string // DB chunk label prefixes (lowercase) that get the subcategory multiplier
+	ResumeHeadings []string // resume section headings (first word, lowercase) kept and boosted
+}
+
+// queryIntents is the fixed intent catalogue. Prototypes are embedded once per provider.
+var queryIntents = []intentSpec{
+	{
+		Name:           "education",
+		Prototypes:     []string{"Where did he study?", "What degree is he pursuing and what is his GPA?", "Which university or college did he attend?", "What coursework did he take?", "What is on his resume or CV?"},
+		Categories:     []string{"resume"},
+		ResumeHeadings: []string{"education"},
+	},
+	{
+		Name:           "projects",
+		Prototypes:     []string{"What projects has he built?", "Tell me about an app he developed.", "Which hackathon projects did he make?", "What technologies did he use in his project?"},
+		Categories:     []string{"db", "resume", "github"},
+		DbLabels:       []string{"project"},
+		ResumeHeadings: []string{"projects"},
+	},
+	{
+		Name:           "experience",
+		Prototypes:     []string{"Where has he worked?", "Tell me about his internship.", "What did he do in his co-op job?", "What is his professional work experience?"},
+		Categories:     []string{"db", "resume"},
+		DbLabels:       []string{"experience"},
+		ResumeHeadings: []string{"experience"},
+	},
+	{
+		Name:           "honors",
+		Prototypes:     []string{"What honors has he received?", "Tell me about his honours program experience.", "What awards or scholarships did he win?"},
+		Categories:     []string{"db", "resume"},
+		DbLabels:       []string{"honors"},
+		ResumeHeadings: []string{"honors"},
+	},
+	{
+		Name:           "skills",
+		Prototypes:     []string{"What are his skills?", "Which programming languages does he know?", "What tools and frameworks is he proficient in?", "How good is he at machine learning?"},
+		Categories:     []string{"db", "resume"},
+		DbLabels:       []string{"skill"},
+		ResumeHeadings: []string{"skills"},
+	},
+	{
+		Name:           "involvement",
+		Prototypes:     []string{"What clubs and organizations is he involved in?", "What volunteering or campus activities does he do?", "Was he a tutor or student leader?"},
+		Categories:     []string{"db", "resume"},
+		DbLabels:       []string{"involvement"},
+		ResumeHeadings: []string{"involvement"},
+	},
+	{
+		Name:           "yearInReview",
+		Prototypes:     []string{"What happened in his year in review?", "Summarize his academic year.", "What did he accomplish last year?"},
+		Categories:     []string{"db"},
+		DbLabels:       []string{"year in review"},
+		ResumeHeadings: []string{"year"},
+	},
+	{
+		Name:       "github",
+		Prototypes: []string{"Show me his GitHub repositories.", "What code has he published on GitHub?", "Which repo contains this project's source code?"},
+		Categories: []string{"github"},
+	},
+	{
+		Name:       "contact",
+		Prototypes: []string{"How can I contact him?", "What is his email address or LinkedIn?", "Is he available for hire or internships?"},
+		Categories: []string{"resume"},
+	},
+}
+
+// QueryIntent is a classified intent with its raw similarity and normalised confidence.
+type QueryIntent struct {
+	Name       string  `json:"name"`
+	Similarity float64 `json:"similarity"`
+	Confidence float64 `json:"confidence"`
+	Detected   bool    `json:"detected"`
+}
+
+// intentTemperature sharpens the softmax over prototype similarities.
+const intentTemperature = 0.05
+
+// Prototype embedding limits: one embedding pass may take intentPrototypeTimeout, and after a
+// failure requests go without intents for intentPrototypeRetry before the next attempt.
+const (
+	intentPrototypeTimeout = 20 * time.Second
+	intentPrototypeRetry   = 30 * time.Second
+)
+
+// Prototype vectors per intent, cached for the embedder that produced them. The lock is only
+// held to read and swap the cache, never while embedding.
+var intentPrototypes = struct {
+	sync.Mutex
+	embedder    string
+	vectors     map[string][]float32
+	embedding   bool      // a request is embedding the prototypes
+	failedFor   string    // embedder of the last failed attempt
+	failedUntil time.Time // no new attempt for failedFor before then
+	err         error
+}{}
+
+// errIntentPrototypesPending is returned while another request embeds the prototypes.
+var errIntentPrototypesPending = errors.New("intent prototypes are being embedded")
+
+// intentPrototypeVectors returns the mean prototype embedding of every intent, embedding them
+// on first use (and again whenever the active embedder or its fitted state changes). Requests
+// arriving while they are embedded, or shortly after a failed attempt, get an error and go
+// without intents instead of waiting.
+func intentPrototypeVectors(ctx context.Context) (map[string][]float32, error) {
+	embedder := activeEmbedder()
+	id := embedderID()
+	intentPrototypes.Lock()
+	switch {
+	case intentPrototypes.vectors != nil && intentPrototypes.embedder == id:
+		defer intentPrototypes.Unlock()
+		return intentPrototypes.vectors, nil
+	case intentPrototypes.embedding:
+		intentPrototypes.Unlock()
+		return nil, errIntentPrototypesPending
+	case intentPrototypes.failedFor == id && time.Now().Before(intentPrototypes.failedUntil):
+		defer intentPrototypes.Unlock()
+		return nil, intentPrototypes.err
+	}
+	intentPrototypes.embedding = true
+	intentPrototypes.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, intentPrototypeTimeout)
+	defer cancel()
+	vectors, err := embedIntentPrototypes(ctx, embedder)
+
+	intentPrototypes.Lock()
+	defer intentPrototypes.Unlock()
+	intentPrototypes.embedding = false
+	if err != nil {
+		log.Println("Intent prototype embedding failed:", err)
+		intentPrototypes.failedFor, intentPrototypes.failedUntil, intentPrototypes.err = id, time.Now().Add(intentPrototypeRetry), err
+		return nil, err
+	}
+	intentPrototypes.embedder = id
+	intentPrototypes.vectors = vectors
+	return vectors, nil
+}
+
+// embedIntentPrototypes embeds the prototypes of every intent with e and averages them per intent.
+func embedIntentPrototypes(ctx context.Context, e Embedder) (map[string][]float32, error) {
+	vectors := make(map[string][]float32, len(queryIntents))
+	for _, spec := range queryIntents {
+		var mean []float32
+		for _, proto := range spec.Prototypes {
+			emb, err := e.Embed(ctx, proto)
+			if err != nil {
+				return nil, err
+			}
+			if mean == nil {
+				mean = make([]float32, len(emb))
+			}
+			// Average unit vectors so long prototypes don't dominate
+			norm := vectorNorm(emb)
+			for i := range mean {
+				if i < len(emb) && norm > 0 {
+					mean[i] += float32(float64(emb[i]) / norm)
+				}
+			}
+		}
+		vectors[spec.Name] = mean
+	}
+	return vectors, nil
+}
+
+// classifyIntents scores the query embedding against every intent prototype. Confidence is a
+// softmax over the similarities; an intent is detected when both its similarity and confidence
+// clear the profile thresholds. Results are sorted by confidence.
+func classifyIntents(qEmb []float32, profile *RetrievalProfile) []QueryIntent {
+	protos, err := intentPrototypeVectors(context.Background())
+	if err != nil {
+		// Logged by the attempt that failed; retrieval goes on without intents meanwhile
+		return nil
+	}
+	qNorm := vectorNorm(qEmb)
+	intents := make([]QueryIntent, 0, len(queryIntents))
+	maxSim := math.Inf(-1)
+	for _, spec := range queryIntents {
+		sim := cosineSimilarity(qEmb, qNorm, protos[spec.Name])
+		intents = append(intents, QueryIntent{Name: spec.Name, Similarity: sim})
+		if sim > maxSim {
+			maxSim = sim
+		}
+	}
+	var total float64
+	for i := range intents {
+		intents[i].Confidence = math.Exp((intents[i].Similarity - maxSim) / intentTemperature)
+		total += intents[i].Confidence
+	}
+	for i := range intents {
+		intents[i].Confidence /= total
+		intents[i].Detected = intents[i].Similarity >= profile.IntentThreshold &&
+			intents[i].Confidence >= profile.IntentMinConfidence
+	}
+	sort.SliceStable(intents, func(i, j int) bool { return intents[i].Confidence > intents[j].Confidence })
+	return intents
+}
+
+// intentPlan is what retrieveContext needs from the classified intents: the boost strength per
+// category, the multiplier strength per DB label and resume heading, and which headings are wanted.
+type intentPlan struct {
+	categoryConfidence map[string]float64
+	dbLabelConfidence  map[string]float64
+	headingConfidence  map[string]float64
+	intentFor          map[string]string // label/heading -> intent name, for trace reasons
+}
+
+// planFromIntents folds the detected intents into per-category, per-label and per-heading
+// confidences (the maximum over intents that point at them).
+func planFromIntents(intents []QueryIntent) intentPlan {
+	plan := intentPlan{
+		categoryConfidence: map[string]float64{},
+		dbLabelConfidence:  map[string]float64{},
+		headingConfidence:  map[string]float64{},
+		intentFor:          map[string]string{},
+	}
+	raise := func(m map[string]float64, key, intent string, conf float64) {
+		if conf > m[key] {
+			m[key] = conf
+			plan.intentFor[key] = intent
+		}
+	}
+	for _, in := range intents {
+		if !in.Detected {
+			continue
+		}
+		for _, spec := range queryIntents {
+			if spec.Name != in.Name {
+				continue
+			}
+			for _, cat := range spec.Categories {
+				raise(plan.categoryConfidence, cat, in.Name, in.Confidence)
+			}
+			for _, label := range spec.DbLabels {
+				raise(plan.dbLabelConfidence, label, in.Name, in.Confidence)
+			}
+			for _, heading := range spec.ResumeHeadings {
+				raise(plan.headingConfidence, heading, in.Name, in.Confidence)
+			}
+		}
+	}
+	return plan
+}
+
+// dbLabelMatch returns the confidence of the most confident intent whose DB label occurs in the
+// chunk label prefix, and that label.
+func (p intentPlan) dbLabelMatch(prefix string) (float64, string) {
+	best, bestLabel := 0.0, ""
+	for label, conf := range p.dbLabelConfidence {
+		if conf > best && strings.Contains(prefix, label) {
+			best, bestLabel = conf, label
+		}
+	}
+	return best, bestLabel
+}
+
+// cosineSimilarity compares vec against a query embedding with a precomputed norm.
+// Vectors of different dimensions are treated as unrelated.
+func cosineSimilarity(q []float32, qNorm float64, vec []float32) float64 {
+	if len(q) != len(vec) || qNorm == 0 {
+		return 0
+	}
+	norm := vectorNorm(vec)
+	if norm == 0 {
+		return 0
+	}
+	var dot float64
+	for i, x := range vec {
+		dot += float64(x) * float64(q[i])
+	}
+	return dot / (norm * qNorm)
+}
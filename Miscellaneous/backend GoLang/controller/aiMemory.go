@@ -0,0 +1,335 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Conversation memory limits
+const (
+	memoryMaxTokens       = 250 // hard cap on the model's memory update
+	memorySummaryMaxWords = 80
+	memoryMaxEntities     = 15
+	memoryMaxOpenTopics   = 5
+)
+
+// memoryEntityTypes are the kinds of things the memory tracks.
+var memoryEntityTypes = []string{"project", "experience", "organization", "skill", "repo", "other"}
+
+// MemoryEntity is something the conversation referred to, with the turn it was last mentioned in.
+type MemoryEntity struct {
+	Type     string `json:"type"`
+	Name     string `json:"name"`
+	LastTurn int    `json:"lastTurn"`
+}
+
+// ConversationMemory is the structured memory of a chat session. The client keeps it as an
+// opaque JSON string and sends it back with every request.
+type ConversationMemory struct {
+	Summary    string         `json:"summary"`
+	Entities   []MemoryEntity `json:"entities"`
+	OpenTopics []string       `json:"openTopics"`
+	Turns      int            `json:"turns"`
+}
+
+// parseConversationMemory decodes the memory sent by the client. Older clients send the prose
+// summary, which becomes the Summary of an otherwise empty memory.
+func parseConversationMemory(raw string) *ConversationMemory {
+	raw = strings.TrimSpace(raw)
+	m := &ConversationMemory{}
+	if raw == "" {
+		return m
+	}
+	if strings.HasPrefix(raw, "{") && json.Unmarshal([]byte(raw), m) == nil {
+		return m
+	}
+	return &ConversationMemory{Summary: raw}
+}
+
+// Encode returns the JSON string handed back to the client.
+func (m *ConversationMemory) Encode() string {
+	raw, _ := json.Marshal(m)
+	return string(raw)
+}
+
+// promptText renders the memory compactly for prompts (empty when there is nothing to say).
+func (m *ConversationMemory) promptText() string {
+	var lines []string
+	if m.Summary != "" {
+		lines = append(lines, "Summary: "+m.Summary)
+	}
+	if len(m.Entities) > 0 {
+		var names []string
+		for _, e := range m.Entities {
+			names = append(names, e.Type+": "+e.Name)
+		}
+		lines = append(lines, "Mentioned (most recent first): "+strings.Join(names, "; "))
+	}
+	if len(m.OpenTopics) > 0 {
+		lines = append(lines, "Open topics: "+strings.Join(m.OpenTopics, "; "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// mention records entities referred to in the given turn, keeping the list ordered by recency
+// (ties broken by name) and capped.
+func (m *ConversationMemory) mention(turn int, entities ...MemoryEntity) {
+	for _, e := range entities {
+		e.Name = strings.TrimSpace(e.Name)
+		if e.Name == "" {
+			continue
+		}
+		if !containsString(memoryEntityTypes, e.Type) {
+			e.Type = "other"
+		}
+		e.LastTurn = turn
+		found := false
+		for i := range m.Entities {
+			if strings.EqualFold(m.Entities[i].Name, e.Name) {
+				m.Entities[i].LastTurn = turn
+				m.Entities[i].Type = e.Type
+				found = true
+				break
+			}
+		}
+		if !found {
+			m.Entities = append(m.Entities, e)
+		}
+	}
+	sort.SliceStable(m.Entities, func(i, j int) bool {
+		if m.Entities[i].LastTurn != m.Entities[j].LastTurn {
+			return m.Entities[i].LastTurn > m.Entities[j].LastTurn
+		}
+		return m.Entities[i].Name < m.Entities[j].Name
+	})
+	if len(m.Entities) > memoryMaxEntities {
+		m.Entities = m.Entities[:memoryMaxEntities]
+	}
+}
+
+// referencePattern matches demonstrative references such as "that project" or "this internship".
+var referencePattern = regexp.MustCompile(`(?i)\b(that|this|the same|said)\s+(project|app|application|internship|job|role|position|co-?op|company|employer|experience|club|organization|organisation|group|event|hackathon|skill|technology|language|framework|tool|repo|repository)\b`)
+
+// referenceTypes maps the noun of a reference to the entity type it points at.
+var referenceTypes = map[string]string{
+	"project": "project", "app": "project", "application": "project",
+	"internship": "experience", "job": "experience", "role": "experience", "position": "experience",
+	"co-op": "experience", "coop": "experience", "company": "experience", "employer": "experience", "experience": "experience",
+	"club": "organization", "organization": "organization", "organisation": "organization", "group": "organization",
+	"event": "organization", "hackathon": "organization",
+	"skill": "skill", "technology": "skill", "language": "skill", "framework": "skill", "tool": "skill",
+	"repo": "repo", "repository": "repo",
+}
+
+// resolveReferences replaces demonstrative references with the most recently mentioned entity of
+// the matching type. References without a matching entity are left as they are.
+func (m *ConversationMemory) resolveReferences(query string) string {
+	return referencePattern.ReplaceAllStringFunc(query, func(match string) string {
+		parts := referencePattern.FindStringSubmatch(match)
+		want := referenceTypes[strings.ToLower(parts[2])]
+		for _, e := range m.Entities { // most recent first
+			if e.Type == want {
+				return e.Name
+			}
+		}
+		return match
+	})
+}
+
+// aliasSeparators split a title into the parts it is also referred to by.
+var aliasSeparators = regexp.MustCompile(`[:|]`)
+
+// knownEntities lists the portfolio items in the memory index as entities, with the aliases
+// they are usually referred to by (the part of "FinVest: Budget Smart, Invest Sharp" before
+// the colon, the company after "Co-op |").
+func knownEntities(index []MemoryItem) map[string]MemoryEntity {
+	tableTypes := map[string]string{
+		"projectTable":          "project",
+		"honorsExperienceTable": "project",
+		"experienceTable":       "experience",
+		"involvementTable":      "organization",
+		"skillsTable":           "skill",
+	}
+	aliases := map[string]MemoryEntity{}
+	owners := map[string]map[string]bool{} // alias -> names of the items it refers to
+	add := func(alias string, e MemoryEntity) {
+		alias = strings.ToLower(strings.TrimSpace(alias))
+		if len(alias) < 4 {
+			return
+		}
+		if owners[alias] == nil {
+			owners[alias] = map[string]bool{}
+		}
+		owners[alias][e.Name] = true
+		aliases[alias] = e
+	}
+	for _, item := range index {
+		parts := strings.SplitN(item.Source, "/", 3)
+		if len(parts) < 2 {
+			continue
+		}
+		var e MemoryEntity
+		switch {
+		case parts[0] == "db" && len(parts) == 3 && tableTypes[parts[1]] != "":
+			e = MemoryEntity{Type: tableTypes[parts[1]], Name: strings.TrimSpace(parts[2])}
+		case parts[0] == "github" && len(parts) == 3:
+			e = MemoryEntity{Type: "repo", Name: parts[2]}
+		default:
+			continue
+		}
+		add(e.Name, e)
+		for _, seg := range aliasSeparators.Split(e.Name, -1) {
+			add(seg, e)
+		}
+	}
+	// Aliases shared by several items (e.g. "Computer Science Co-op") are ambiguous
+	for alias, names := range owners {
+		if len(names) > 1 {
+			delete(aliases, alias)
+		}
+	}
+	return aliases
+}
+
+// detectKnownEntities finds the portfolio items mentioned by name in text.
+func detectKnownEntities(text string, known map[string]MemoryEntity) []MemoryEntity {
+	lower := strings.ToLower(text)
+	var found []MemoryEntity
+	names := map[string]bool{}
+	for alias, e := range known {
+		if !names[e.Name] && containsPhrase(lower, alias) {
+			names[e.Name] = true
+			found = append(found, e)
+		}
+	}
+	return found
+}
+
+// containsPhrase reports whether phrase occurs in text with no letter or digit directly around it.
+func containsPhrase(text, phrase string) bool {
+	isWord := func(b byte) bool {
+		return b >= 'a' && b <= 'z' || b >= '0' && b <= '9'
+	}
+	for from := 0; ; {
+		i := strings.Index(text[from:], phrase)
+		if i < 0 {
+			return false
+		}
+		start, end := from+i, from+i+len(phrase)
+		if (start == 0 || !isWord(text[start-1])) && (end == len(text) || !isWord(text[end])) {
+			return true
+		}
+		from = start + 1
+	}
+}
+
+// memoryUpdateSchema is the structured output the chat model returns for a memory update.
+var memoryUpdateSchema = json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"summary": {"type": "string"},
+		"openTopics": {"type": "array", "items": {"type": "string"}},
+		"entities": {
+			"type": "array",
+			"items": {
+				"type": "object",
+				"properties": {
+					"type": {"type": "string", "enum": ["project", "experience", "organization", "skill", "repo", "other"]},
+					"name": {"type": "string"}
+				},
+				"required": ["type", "name"],
+				"additionalProperties": false
+			}
+		}
+	},
+	"required": ["summary", "openTopics", "entities"],
+	"additionalProperties": false
+}`)
+
+// snapshotMemoryUpdate folds the latest Q&A into the structured conversation memory. The model
+// writes the summary, open topics and the entities of this exchange (as structured output under a
+// hard token cap); portfolio items named in the exchange are also tracked deterministically.
+func snapshotMemoryUpdate(ctx context.Context, previousMemory string, query string, answer string) (*ConversationMemory, string, error) {
+	if strings.TrimSpace(query) == "" || strings.TrimSpace(answer) == "" {
+		return nil, "", fmt.Errorf("Query and response are required for memory update")
+	}
+	memory := parseConversationMemory(previousMemory)
+	prompt, err := renderPrompt(promptMemoryUpdate, promptData{
+		Memory:    memory.promptText(),
+		Query:     query,
+		Answer:    answer,
+		MaxWords:  memorySummaryMaxWords,
+		MaxTopics: memoryMaxOpenTopics,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	// The profile can lower the cap (validation keeps it from raising it); without one the cap applies
+	raw, _, err := completeTask(ctx, taskMemory, openai.ChatCompletionRequest{
+		MaxTokens: memoryMaxTokens,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: prompt.System},
+			{Role: openai.ChatMessageRoleUser, Content: prompt.User},
+		},
+		ResponseFormat: &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+			JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+				Name:   "conversation_memory",
+				Schema: memoryUpdateSchema,
+				Strict: true,
+			},
+		},
+	})
+	if err != nil {
+		return nil, prompt.Ref, err
+	}
+	var update struct {
+		Summary    string         `json:"summary"`
+		OpenTopics []string       `json:"openTopics"`
+		Entities   []MemoryEntity `json:"entities"`
+	}
+	if err := json.Unmarshal([]byte(raw), &update); err != nil {
+		// A response cut off by the token cap is not valid JSON; keep the previous memory
+		return nil, prompt.Ref, fmt.Errorf("invalid memory update output: %w", err)
+	}
+	memory.Turns++
+	memory.Summary = truncateWords(strings.TrimSpace(update.Summary), memorySummaryMaxWords)
+	memory.OpenTopics = nil
+	for _, topic := range update.OpenTopics {
+		if topic = strings.TrimSpace(topic); topic != "" && len(memory.OpenTopics) < memoryMaxOpenTopics {
+			memory.OpenTopics = append(memory.OpenTopics, topic)
+		}
+	}
+	ensureMemoryIndex()
+	known := knownEntities(currentIndex().Items)
+	// Use the indexed name for entities the model wrote as an alias ("FinVest")
+	for i, e := range update.Entities {
+		if k, ok := known[strings.ToLower(strings.TrimSpace(e.Name))]; ok {
+			update.Entities[i] = k
+		}
+	}
+	memory.mention(memory.Turns, update.Entities...)
+	memory.mention(memory.Turns, detectKnownEntities(query+"\n"+answer, known)...)
+	return memory, prompt.Ref, nil
+}
+
+// SnapshotMemoryUpdate updates the structured conversation memory with the latest Q&A and returns
+// the prompt template version used.
+func SnapshotMemoryUpdate(ctx context.Context, previousMemory string, query string, answer string) (*ConversationMemory, string, error) {
+	return snapshotMemoryUpdate(ctx, previousMemory, query, answer)
+}
+
+// truncateWords keeps at most max words of text.
+func truncateWords(text string, max int) string {
+	words := strings.Fields(text)
+	if len(words) <= max {
+		return text
+	}
+	return strings.Join(words[:max], " ") + "…"
+}
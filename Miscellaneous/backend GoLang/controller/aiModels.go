@@ -0,0 +1,339 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/portfolio-backend/config"
+	"github.com/gin-gonic/gin"
+	openai "github.com/sashabaranov/go-openai"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Model routing tasks. Retrieval ranks chunks without a model, so there is no rerank task.
+const (
+	taskAnswer    = "answer"    // visitor answers, RAG and tool mode
+	taskRewrite   = "rewrite"   // query optimization
+	taskFollowUps = "followups" // follow-up question suggestions
+	taskMemory    = "memory"    // conversation memory updates
+	taskEmbed     = "embed"     // provider embeddings
+	taskGrade     = "grade"     // eval answer grading
+)
+
+// defaultEmbedModel is the embedding model indexes were built with before routing was
+// configurable; the provider keeps the plain "openai" embedder name for it.
+const defaultEmbedModel = "text-embedding-3-small"
+
+// ModelProfile configures the model calls of one task. Fallbacks are tried in order when the
+// primary model fails or times out.
+type ModelProfile struct {
+	Model       string   `bson:"model" json:"model"`
+	Temperature float32  `bson:"temperature" json:"temperature"`
+	MaxTokens   int      `bson:"maxTokens" json:"maxTokens"` // 0 leaves the limit to the caller
+	TimeoutMs   int      `bson:"timeoutMs" json:"timeoutMs"` // per attempt; 0 means no timeout
+	Fallbacks   []string `bson:"fallbacks" json:"fallbacks"`
+}
+
+// ModelRouting holds the model profile of every task. It is stored as a single document in the
+// "modelRouting" collection of the AI DB.
+type ModelRouting struct {
+	Profiles  map[string]ModelProfile `bson:"profiles" json:"profiles"`
+	UpdatedAt time.Time               `bson:"updatedAt" json:"updatedAt"`
+}
+
+// defaultModelRouting returns the built-in routing. The model and fallbacks of each task can be
+// set with AI_MODEL_<TASK> and AI_MODEL_<TASK>_FALLBACKS (comma separated).
+func defaultModelRouting() *ModelRouting {
+	profiles := map[string]ModelProfile{
+		taskAnswer:    {Model: "gpt-4.1-nano", Temperature: 0.3, MaxTokens: 400, TimeoutMs: 30000},
+		taskRewrite:   {Model: "gpt-4.1-nano", Temperature: 0.3, TimeoutMs: 15000},
+		taskFollowUps: {Model: "gpt-4.1-nano", Temperature: 0.6, MaxTokens: 300, TimeoutMs: 20000},
+		taskMemory:    {Model: "gpt-4.1-nano", Temperature: 0.2, MaxTokens: memoryMaxTokens, TimeoutMs: 20000},
+		taskEmbed:     {Model: defaultEmbedModel, TimeoutMs: 15000},
+		taskGrade:     {Model: "gpt-4o-mini", Temperature: 0, MaxTokens: 5, TimeoutMs: 30000},
+	}
+	for task, p := range profiles {
+		env := "AI_MODEL_" + strings.ToUpper(task)
+		p.Model = config.EnvString(env, p.Model)
+		if raw := config.EnvString(env+"_FALLBACKS", ""); raw != "" {
+			for _, m := range strings.Split(raw, ",") {
+				if m = strings.TrimSpace(m); m != "" {
+					p.Fallbacks = append(p.Fallbacks, m)
+				}
+			}
+		}
+		profiles[task] = p
+	}
+	return &ModelRouting{Profiles: profiles}
+}
+
+// Active model routing
+var modelRoutingState = struct {
+	sync.RWMutex
+	routing *ModelRouting
+}{}
+
+// currentModelRouting returns the active routing.
+func currentModelRouting() *ModelRouting {
+	modelRoutingState.RLock()
+	defer modelRoutingState.RUnlock()
+	if modelRoutingState.routing == nil {
+		return defaultModelRouting()
+	}
+	return modelRoutingState.routing
+}
+
+// validateModelProfile checks one task profile.
+func validateModelProfile(task string, p ModelProfile) []string {
+	var errs []string
+	if strings.TrimSpace(p.Model) == "" {
+		errs = append(errs, task+": model is required")
+	}
+	if p.Temperature < 0 || p.Temperature > 2 {
+		errs = append(errs, task+": temperature must be between 0 and 2")
+	}
+	if p.MaxTokens < 0 || p.TimeoutMs < 0 {
+		errs = append(errs, task+": maxTokens and timeoutMs must not be negative")
+	}
+	// The memory update is a hard-capped JSON document; more tokens only grow the memory
+	if task == taskMemory && p.MaxTokens > memoryMaxTokens {
+		errs = append(errs, fmt.Sprintf("%s: maxTokens must be at most %d", task, memoryMaxTokens))
+	}
+	// Another embedding model produces vectors the index can't be compared with
+	if task == taskEmbed && len(p.Fallbacks) > 0 {
+		errs = append(errs, task+": embedding fallbacks are not supported")
+	}
+	return errs
+}
+
+// validate checks the routing; tasks missing from it keep their default profile.
+func (r *ModelRouting) validate() []string {
+	var errs []string
+	defaults := defaultModelRouting().Profiles
+	for task, p := range r.Profiles {
+		if _, ok := defaults[task]; !ok {
+			errs = append(errs, fmt.Sprintf("unknown task %q", task))
+			continue
+		}
+		errs = append(errs, validateModelProfile(task, p)...)
+	}
+	for task, p := range defaults {
+		if _, ok := r.Profiles[task]; !ok {
+			r.Profiles[task] = p
+		}
+	}
+	sort.Strings(errs)
+	return errs
+}
+
+// reloadModelRouting loads the stored routing, keeping the previous one if it is missing or invalid.
+func reloadModelRouting(ctx context.Context) {
+	r := &ModelRouting{}
+	err := config.GetDBAI().Collection("modelRouting").FindOne(ctx, bson.M{"_id": "modelRouting"}).Decode(r)
+	if err != nil {
+		return
+	}
+	if r.Profiles == nil {
+		r.Profiles = map[string]ModelProfile{}
+	}
+	if errs := r.validate(); len(errs) > 0 {
+		log.Printf("Invalid model routing, keeping previous: %s", strings.Join(errs, "; "))
+		return
+	}
+	modelRoutingState.Lock()
+	modelRoutingState.routing = r
+	modelRoutingState.Unlock()
+}
+
+// -- Per-request overrides --
+
+// ModelOverride replaces parts of a task profile for one request; unset fields keep the
+// configured values.
+type ModelOverride struct {
+	Model       string   `json:"model"`
+	Temperature *float32 `json:"temperature"`
+	MaxTokens   int      `json:"maxTokens"`
+	TimeoutMs   int      `json:"timeoutMs"`
+	Fallbacks   []string `json:"fallbacks"`
+}
+
+// modelOverridesKey is the context key of the per-request overrides.
+type modelOverridesKey struct{}
+
+// errModelOverrideForbidden is returned when a visitor without an admin session sends overrides.
+var errModelOverrideForbidden = errors.New("model overrides are only allowed for admins")
+
+// IsModelOverrideForbidden reports whether err rejected overrides from a non-admin request.
+func IsModelOverrideForbidden(err error) bool {
+	return errors.Is(err, errModelOverrideForbidden)
+}
+
+// ModelOverrideContext returns the request context carrying the model overrides of an admin
+// request, for experimenting with models without changing the routing. Embeddings can't be
+// overridden, since query vectors must match the index.
+func ModelOverrideContext(c *gin.Context, overrides map[string]ModelOverride) (context.Context, error) {
+	ctx := c.Request.Context()
+	if len(overrides) == 0 {
+		return ctx, nil
+	}
+	if !isAdminRequest(c) {
+		return nil, errModelOverrideForbidden
+	}
+	routing := currentModelRouting()
+	var errs []string
+	for task, o := range overrides {
+		base, ok := routing.Profiles[task]
+		if !ok || task == taskEmbed {
+			errs = append(errs, fmt.Sprintf("task %q can't be overridden", task))
+			continue
+		}
+		errs = append(errs, validateModelProfile(task, base.with(o))...)
+	}
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return nil, fmt.Errorf("invalid model overrides: %s", strings.Join(errs, "; "))
+	}
+	return context.WithValue(ctx, modelOverridesKey{}, overrides), nil
+}
+
+// hasModelOverrides reports whether ctx carries per-request model overrides.
+func hasModelOverrides(ctx context.Context) bool {
+	overrides, _ := ctx.Value(modelOverridesKey{}).(map[string]ModelOverride)
+	return len(overrides) > 0
+}
+
+// with applies an override to the profile.
+func (p ModelProfile) with(o ModelOverride) ModelProfile {
+	if o.Model != "" {
+		p.Model = o.Model
+	}
+	if o.Temperature != nil {
+		p.Temperature = *o.Temperature
+	}
+	if o.MaxTokens > 0 {
+		p.MaxTokens = o.MaxTokens
+	}
+	if o.TimeoutMs > 0 {
+		p.TimeoutMs = o.TimeoutMs
+	}
+	if o.Fallbacks != nil {
+		p.Fallbacks = o.Fallbacks
+	}
+	return p
+}
+
+// modelProfile returns the profile of task for this request.
+func modelProfile(ctx context.Context, task string) ModelProfile {
+	p := currentModelRouting().Profiles[task]
+	if overrides, ok := ctx.Value(modelOverridesKey{}).(map[string]ModelOverride); ok {
+		if o, ok := overrides[task]; ok {
+			p = p.with(o)
+		}
+	}
+	return p
+}
+
+// -- Routed calls --
+
+// routeModels runs call with the task's primary model and then each fallback in order until
+// one succeeds, applying the profile's sampling settings. Each model is retried with backoff
+// and the profile's per-attempt timeout before falling back. It returns the model that
+// answered, or the last one tried.
+func routeModels(ctx context.Context, task string, req openai.ChatCompletionRequest, call func(context.Context, openai.ChatCompletionRequest) error) (string, error) {
+	p := modelProfile(ctx, task)
+	ctx = withUsageTask(ctx, task)
+	req.Temperature = p.Temperature
+	if p.MaxTokens > 0 {
+		req.MaxTokens = p.MaxTokens
+	}
+	var err error
+	for i, model := range append([]string{p.Model}, p.Fallbacks...) {
+		if i > 0 {
+			log.Printf("Model %s failed for %s (%v), falling back to %s", req.Model, task, err, model)
+		}
+		req.Model = model
+		err = callProvider(ctx, time.Duration(p.TimeoutMs)*time.Millisecond, func(ctx context.Context) error {
+			return call(ctx, req)
+		})
+		// The visitor went away or the provider is down; other models won't help
+		if err == nil || ctx.Err() != nil || errors.Is(err, errCircuitOpen) {
+			break
+		}
+	}
+	return req.Model, err
+}
+
+// completeTask runs a chat completion for task on the routed models and returns the reply and
+// the model that produced it.
+func completeTask(ctx context.Context, task string, req openai.ChatCompletionRequest) (string, string, error) {
+	var out string
+	model, err := routeModels(ctx, task, req, func(ctx context.Context, req openai.ChatCompletionRequest) error {
+		var err error
+		out, err = aiProvider.Complete(ctx, req)
+		return err
+	})
+	return out, model, err
+}
+
+// completeTaskMessage is completeTask for tool-calling requests.
+func completeTaskMessage(ctx context.Context, caller ToolCaller, task string, req openai.ChatCompletionRequest) (openai.ChatCompletionMessage, string, error) {
+	var msg openai.ChatCompletionMessage
+	model, err := routeModels(ctx, task, req, func(ctx context.Context, req openai.ChatCompletionRequest) error {
+		var err error
+		msg, err = caller.CompleteMessage(ctx, req)
+		return err
+	})
+	return msg, model, err
+}
+
+// -- Admin handlers --
+
+// GetModelRouting returns the active model routing.
+func GetModelRouting(c *gin.Context) {
+	c.JSON(http.StatusOK, currentModelRouting())
+}
+
+// PutModelRouting validates, stores and activates a model routing. Tasks left out keep their
+// default profile. The answer cache is emptied, and changing the embedding model re-embeds the
+// index in the background.
+func PutModelRouting(c *gin.Context) {
+	ctx := c.Request.Context()
+	r := &ModelRouting{}
+	if err := c.BindJSON(r); err != nil || r.Profiles == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid model routing data"})
+		return
+	}
+	if errs := r.validate(); len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid model routing", "errors": errs})
+		return
+	}
+	r.UpdatedAt = time.Now()
+	_, err := config.GetDBAI().Collection("modelRouting").UpdateOne(ctx,
+		bson.M{"_id": "modelRouting"},
+		bson.M{"$set": r},
+		optionsUpsert(),
+	)
+	if err != nil {
+		log.Println("Error saving model routing:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving model routing"})
+		return
+	}
+	modelRoutingState.Lock()
+	modelRoutingState.routing = r
+	modelRoutingState.Unlock()
+	// Cached answers were written by the previous answer models
+	if _, err := purgeAnswerCache(ctx); err != nil {
+		log.Println("Error purging answer cache:", err)
+	}
+	if idx := currentIndex(); len(idx.Items) > 0 && configuredEmbedder().Name() != idx.Meta.Embedder {
+		startIndexMigration()
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Model routing saved.", "routing": r})
+}
@@ -0,0 +1,167 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/portfolio-backend/config"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// PersonaProfile describes the portfolio owner and how the chatbot speaks about them. It is
+// templated into every prompt and stored as a single document in the "personaProfile"
+// collection of the AI DB; until one is stored the defaults come from the environment.
+type PersonaProfile struct {
+	FullName    string    `bson:"fullName" json:"fullName"`   // introduces the owner in system prompts
+	ShortName   string    `bson:"shortName" json:"shortName"` // how answers refer to the owner
+	Pronouns    Pronouns  `bson:"pronouns" json:"pronouns"`
+	Tone        string    `bson:"tone" json:"tone"`               // style instruction for answers
+	AvoidTopics []string  `bson:"avoidTopics" json:"avoidTopics"` // topics the assistant declines to discuss
+	ContactCTA  string    `bson:"contactCta" json:"contactCta"`   // appended when visitors ask how to reach or hire the owner
+	Greeting    string    `bson:"greeting" json:"greeting"`       // reply to greetings, also shown by the chat widget
+	UpdatedAt   time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+// Pronouns of the portfolio owner, e.g. he/him/his or they/them/their.
+type Pronouns struct {
+	Subject    string `bson:"subject" json:"subject"`
+	Object     string `bson:"object" json:"object"`
+	Possessive string `bson:"possessive" json:"possessive"`
+}
+
+// defaultPersona returns the persona used until one is stored. AI_OWNER_PRONOUNS is
+// "subject/object/possessive".
+func defaultPersona() *PersonaProfile {
+	p := &PersonaProfile{
+		FullName:  config.EnvString("AI_OWNER_NAME", "VENKATA SRIMANNARAYANA YASAM"),
+		ShortName: config.EnvString("AI_OWNER_SHORT_NAME", "Venkata"),
+		Pronouns:  Pronouns{Subject: "he", Object: "him", Possessive: "his"},
+		Tone:      config.EnvString("AI_PERSONA_TONE", "Be concise and factual"),
+	}
+	if parts := strings.Split(config.EnvString("AI_OWNER_PRONOUNS", ""), "/"); len(parts) == 3 {
+		p.Pronouns = Pronouns{Subject: parts[0], Object: parts[1], Possessive: parts[2]}
+	}
+	p.ContactCTA = config.EnvString("AI_PERSONA_CONTACT_CTA", "")
+	p.Greeting = config.EnvString("AI_PERSONA_GREETING", fmt.Sprintf("Hi! I'm %s portfolio assistant. Ask me about %s education, projects, skills or experience.", p.possessiveName(), p.Pronouns.Possessive))
+	return p
+}
+
+// Active persona
+var personaState = struct {
+	sync.RWMutex
+	persona *PersonaProfile
+}{}
+
+// currentPersona returns the active persona.
+func currentPersona() *PersonaProfile {
+	personaState.RLock()
+	defer personaState.RUnlock()
+	if personaState.persona == nil {
+		return defaultPersona()
+	}
+	return personaState.persona
+}
+
+// possessiveName is the short name in the possessive, e.g. "Venkata's".
+func (p *PersonaProfile) possessiveName() string {
+	if strings.HasSuffix(p.ShortName, "s") {
+		return p.ShortName + "'"
+	}
+	return p.ShortName + "'s"
+}
+
+// refusalMessage is the default reply to blocked injection attempts.
+func (p *PersonaProfile) refusalMessage() string {
+	return fmt.Sprintf("I can only answer questions about %s background, projects and experience.", p.possessiveName())
+}
+
+// offTopicMessage is the default reply to off-topic queries.
+func (p *PersonaProfile) offTopicMessage() string {
+	return fmt.Sprintf("I'm %s portfolio assistant, so I can only help with questions about %s education, projects, skills and experience.", p.possessiveName(), p.Pronouns.Possessive)
+}
+
+// validate checks the persona; an empty tone falls back to the default one.
+func (p *PersonaProfile) validate() []string {
+	var errs []string
+	if strings.TrimSpace(p.FullName) == "" {
+		errs = append(errs, "fullName is required")
+	}
+	if strings.TrimSpace(p.ShortName) == "" {
+		errs = append(errs, "shortName is required")
+	}
+	if p.Pronouns.Subject == "" || p.Pronouns.Object == "" || p.Pronouns.Possessive == "" {
+		errs = append(errs, "pronouns need subject, object and possessive")
+	}
+	for _, field := range []string{p.FullName, p.ShortName, p.Tone, p.ContactCTA, p.Greeting} {
+		if strings.Contains(field, "<<<") || strings.Contains(field, ">>>") {
+			errs = append(errs, "persona fields must not contain <<< or >>>")
+			break
+		}
+	}
+	if strings.TrimSpace(p.Tone) == "" {
+		p.Tone = "Be concise and factual"
+	}
+	return errs
+}
+
+// reloadPersona loads the stored persona, keeping the previous one if it is missing or invalid.
+func reloadPersona(ctx context.Context) {
+	p := defaultPersona()
+	err := config.GetDBAI().Collection("personaProfile").FindOne(ctx, bson.M{"_id": "personaProfile"}).Decode(p)
+	if err != nil {
+		return
+	}
+	if errs := p.validate(); len(errs) > 0 {
+		log.Printf("Invalid persona profile, keeping previous: %s", strings.Join(errs, "; "))
+		return
+	}
+	personaState.Lock()
+	personaState.persona = p
+	personaState.Unlock()
+}
+
+// -- Handlers --
+
+// GetPersona returns the active persona; the chat widget uses its name and greeting.
+func GetPersona(c *gin.Context) {
+	c.JSON(http.StatusOK, currentPersona())
+}
+
+// PutPersona validates, stores and activates a persona profile.
+func PutPersona(c *gin.Context) {
+	ctx := c.Request.Context()
+	p := defaultPersona()
+	if err := c.BindJSON(p); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid persona profile data"})
+		return
+	}
+	if errs := p.validate(); len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid persona profile", "errors": errs})
+		return
+	}
+	p.UpdatedAt = time.Now()
+	_, err := config.GetDBAI().Collection("personaProfile").UpdateOne(ctx,
+		bson.M{"_id": "personaProfile"},
+		bson.M{"$set": p},
+		optionsUpsert(),
+	)
+	if err != nil {
+		log.Println("Error saving persona profile:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving persona profile"})
+		return
+	}
+	personaState.Lock()
+	personaState.persona = p
+	personaState.Unlock()
+	// Cached answers were written with the previous persona
+	if _, err := purgeAnswerCache(ctx); err != nil {
+		log.Println("Error purging answer cache:", err)
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Persona profile saved.", "persona": p})
+}
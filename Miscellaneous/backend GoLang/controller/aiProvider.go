@@ -0,0 +1,180 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"time"
+	"unicode"
+
+	"example.com/portfolio-backend/config"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Provider abstracts the embedding and chat-completion calls used by the AI pipeline,
+// so retrieval can run against OpenAI in production and a deterministic fake offline.
+type Provider interface {
+	Name() string
+	Embed(ctx context.Context, text string) ([]float32, error)
+	Complete(ctx context.Context, req openai.ChatCompletionRequest) (string, error)
+}
+
+// ToolCaller is implemented by providers whose chat models can call tools. It returns the whole
+// assistant message so the caller can see requested tool calls as well as content.
+type ToolCaller interface {
+	CompleteMessage(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionMessage, error)
+}
+
+// aiProvider is the provider used by getEmbedding and the chat helpers.
+var aiProvider Provider = openAIProvider{}
+
+// SetProvider replaces the active AI provider (e.g. with the fake provider for evals).
+func SetProvider(p Provider) {
+	if p != nil {
+		aiProvider = p
+	}
+}
+
+// openAIProvider calls the OpenAI API through the global config client. Chat models are chosen
+// by the caller; embeddings use embedModel, or the routed embed model when it is empty.
+type openAIProvider struct {
+	embedModel string
+}
+
+// Name identifies the provider's embeddings: "openai" for the default embedding model,
+// "openai:<model>" for any other.
+func (p openAIProvider) Name() string {
+	if model := p.model(); model != defaultEmbedModel {
+		return "openai:" + model
+	}
+	return "openai"
+}
+
+// model is the embedding model in use.
+func (p openAIProvider) model() string {
+	if p.embedModel != "" {
+		return p.embedModel
+	}
+	return currentModelRouting().Profiles[taskEmbed].Model
+}
+
+// pinned returns the provider with its embedding model fixed, so an index keeps being queried
+// with the model that built it when the routing changes.
+func (p openAIProvider) pinned() openAIProvider {
+	return openAIProvider{embedModel: p.model()}
+}
+
+func (p openAIProvider) Embed(ctx context.Context, text string) ([]float32, error) {
+	timeout := time.Duration(currentModelRouting().Profiles[taskEmbed].TimeoutMs) * time.Millisecond
+	var resp openai.EmbeddingResponse
+	err := callProvider(withUsageTask(ctx, taskEmbed), timeout, func(ctx context.Context) error {
+		start := time.Now()
+		var err error
+		resp, err = config.OpenAIClient.CreateEmbeddings(ctx, openai.EmbeddingRequest{
+			Model: openai.EmbeddingModel(p.model()),
+			Input: []string{text},
+		})
+		if err == nil {
+			recordUsage(ctx, p.model(), resp.Usage, time.Since(start))
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Data) == 0 {
+		return nil, fmt.Errorf("no embedding returned")
+	}
+	embedding := resp.Data[0].Embedding
+	// Convert []float64 to []float32 for memory efficiency
+	vec := make([]float32, len(embedding))
+	for i, v := range embedding {
+		vec[i] = float32(v)
+	}
+	return vec, nil
+}
+
+func (openAIProvider) Complete(ctx context.Context, req openai.ChatCompletionRequest) (string, error) {
+	start := time.Now()
+	resp, err := config.OpenAIClient.CreateChatCompletion(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	recordUsage(ctx, req.Model, resp.Usage, time.Since(start))
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("no completion returned")
+	}
+	return resp.Choices[0].Message.Content, nil
+}
+
+func (openAIProvider) CompleteMessage(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionMessage, error) {
+	start := time.Now()
+	resp, err := config.OpenAIClient.CreateChatCompletion(ctx, req)
+	if err != nil {
+		return openai.ChatCompletionMessage{}, err
+	}
+	recordUsage(ctx, req.Model, resp.Usage, time.Since(start))
+	if len(resp.Choices) == 0 {
+		return openai.ChatCompletionMessage{}, fmt.Errorf("no completion returned")
+	}
+	return resp.Choices[0].Message, nil
+}
+
+// fakeEmbeddingDim is the vector size produced by the fake provider.
+const fakeEmbeddingDim = 256
+
+// FakeProvider is a deterministic, network-free provider. Embeddings are hashed
+// bag-of-words vectors, so lexically similar texts score as similar; completions
+// return Reply if set, otherwise the first line of the last user message.
+type FakeProvider struct {
+	Reply func(req openai.ChatCompletionRequest) string
+}
+
+func (FakeProvider) Name() string { return "fake" }
+
+func (FakeProvider) Embed(ctx context.Context, text string) ([]float32, error) {
+	vec := make([]float32, fakeEmbeddingDim)
+	for _, tok := range tokenize(text) {
+		h := fnv.New32a()
+		h.Write([]byte(tok))
+		sum := h.Sum32()
+		// Use one hash bit for the sign to reduce collision bias
+		if sum&1 == 0 {
+			vec[int(sum>>1)%fakeEmbeddingDim] += 1
+		} else {
+			vec[int(sum>>1)%fakeEmbeddingDim] -= 1
+		}
+	}
+	return vec, nil
+}
+
+func (f FakeProvider) Complete(ctx context.Context, req openai.ChatCompletionRequest) (string, error) {
+	if f.Reply != nil {
+		return f.Reply(req), nil
+	}
+	for i := len(req.Messages) - 1; i >= 0; i-- {
+		if req.Messages[i].Role == openai.ChatMessageRoleUser {
+			line := strings.TrimSpace(strings.SplitN(req.Messages[i].Content, "\n", 2)[0])
+			return line, nil
+		}
+	}
+	return "", nil
+}
+
+// tokenize lowercases text and splits it into alphanumeric tokens.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// vectorNorm returns the Euclidean norm of vec.
+func vectorNorm(vec []float32) float64 {
+	var sum float64
+	for _, x := range vec {
+		sum += float64(x) * float64(x)
+	}
+	return math.Sqrt(sum)
+}
@@ -0,0 +1,198 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"example.com/portfolio-backend/config"
+	"github.com/gin-gonic/gin"
+)
+
+// Background initialization retry settings
+var (
+	initRetryMin = config.EnvDuration("AI_INIT_RETRY_MIN", 15*time.Second)
+	initRetryMax = config.EnvDuration("AI_INIT_RETRY_MAX", 5*time.Minute)
+)
+
+// initBuildRetryAfter is the Retry-After sent while initialization is running.
+const initBuildRetryAfter = 10 * time.Second
+
+// State of the background AI context initialization
+var aiInit = struct {
+	sync.RWMutex
+	ready       bool
+	phase       string
+	attempts    int
+	lastError   string
+	startedAt   time.Time
+	readyAt     time.Time
+	nextAttempt time.Time
+	refreshes   map[string]snapshotRefresh
+}{phase: "not started", refreshes: map[string]snapshotRefresh{}}
+
+// snapshotRefresh is the outcome of the last refresh of one context snapshot.
+type snapshotRefresh struct {
+	At    time.Time `json:"at"`
+	Error string    `json:"error,omitempty"`
+}
+
+// StartContextInit runs InitContext in the background, retrying with exponential backoff until
+// it succeeds. AI routes answer 503 until then, while the rest of the API serves normally.
+func StartContextInit() {
+	aiInit.Lock()
+	aiInit.startedAt = time.Now()
+	aiInit.Unlock()
+	go func() {
+		delay := initRetryMin
+		for {
+			aiInit.Lock()
+			aiInit.attempts++
+			aiInit.nextAttempt = time.Time{}
+			aiInit.Unlock()
+			err := InitContext()
+			if err == nil {
+				aiInit.Lock()
+				aiInit.ready, aiInit.phase, aiInit.lastError, aiInit.readyAt = true, "ready", "", time.Now()
+				elapsed := aiInit.readyAt.Sub(aiInit.startedAt)
+				aiInit.Unlock()
+				log.Printf("✅ AI context ready after %s", elapsed.Round(time.Millisecond))
+				return
+			}
+			log.Printf("AI context initialization failed, retrying in %s: %v", delay, err)
+			aiInit.Lock()
+			aiInit.phase, aiInit.lastError, aiInit.nextAttempt = "waiting to retry", err.Error(), time.Now().Add(delay)
+			aiInit.Unlock()
+			time.Sleep(delay)
+			if delay *= 2; delay > initRetryMax {
+				delay = initRetryMax
+			}
+		}
+	}()
+}
+
+// setInitPhase records what initialization is doing, for /readyz.
+func setInitPhase(phase string) {
+	aiInit.Lock()
+	if !aiInit.ready {
+		aiInit.phase = phase
+	}
+	aiInit.Unlock()
+}
+
+// recordSnapshotRefresh records the outcome of a context snapshot refresh, for /readyz.
+func recordSnapshotRefresh(name string, err error) {
+	r := snapshotRefresh{At: time.Now()}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	aiInit.Lock()
+	aiInit.refreshes[name] = r
+	aiInit.Unlock()
+}
+
+// RequireAIReady answers 503 with a Retry-After header until the AI context is ready.
+func RequireAIReady(c *gin.Context) {
+	aiInit.RLock()
+	ready, phase, next := aiInit.ready, aiInit.phase, aiInit.nextAttempt
+	aiInit.RUnlock()
+	if ready {
+		c.Next()
+		return
+	}
+	retryAfter := initBuildRetryAfter
+	if wait := time.Until(next); wait > retryAfter {
+		retryAfter = wait
+	}
+	c.Header("Retry-After", strconv.Itoa(int(retryAfter.Round(time.Second).Seconds())))
+	c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+		"message": "The AI assistant is starting up. Please try again shortly.",
+		"status":  phase,
+	})
+}
+
+// Readyz reports per-component readiness: MongoDB, the AI provider and its circuit breaker, the
+// memory index and the age of each context snapshot. It answers 200 once the AI context is ready and MongoDB is
+// reachable, 503 otherwise. The endpoint is public, so error details and init attempts are only
+// included for admins.
+func Readyz(c *gin.Context) {
+	admin := isAdminRequest(c)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Second)
+	defer cancel()
+	mongoErr := config.PingDB(ctx)
+	mongo := gin.H{"ok": mongoErr == nil}
+	if mongoErr != nil && admin {
+		mongo["error"] = mongoErr.Error()
+	}
+
+	aiInit.RLock()
+	ready := aiInit.ready
+	initStatus := gin.H{"ready": aiInit.ready, "phase": aiInit.phase}
+	if admin {
+		initStatus["attempts"], initStatus["startedAt"] = aiInit.attempts, aiInit.startedAt
+		if aiInit.lastError != "" {
+			initStatus["lastError"] = aiInit.lastError
+		}
+		if !aiInit.readyAt.IsZero() {
+			initStatus["readyAt"] = aiInit.readyAt
+		}
+		if !aiInit.nextAttempt.IsZero() {
+			initStatus["nextAttempt"] = aiInit.nextAttempt
+		}
+	}
+	refreshes := make(map[string]snapshotRefresh, len(aiInit.refreshes))
+	for name, r := range aiInit.refreshes {
+		if !admin {
+			r.Error = ""
+		}
+		refreshes[name] = r
+	}
+	aiInit.RUnlock()
+
+	meta := currentContextMeta()
+	snapshots := gin.H{}
+	for name, lastUpdate := range map[string]string{
+		"DB":     meta.DbContextLastUpdate,
+		"GitHub": meta.GithubContextLastUpdate,
+		"Resume": meta.ResumeContextLastUpdate,
+	} {
+		s := gin.H{"lastUpdate": lastUpdate}
+		if lastUpdate != "" {
+			s["ageSeconds"] = int(time.Since(parseTime(lastUpdate)).Seconds())
+		}
+		if r, ok := refreshes[name]; ok {
+			s["lastRefresh"] = r
+		}
+		snapshots[name] = s
+	}
+
+	idx := currentIndex()
+	status := http.StatusOK
+	if !ready || mongoErr != nil {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, gin.H{
+		"ready": ready,
+		"init":  initStatus,
+		"mongo": mongo,
+		"provider": gin.H{
+			"name":       aiProvider.Name(),
+			"configured": aiProvider.Name() != (openAIProvider{}).Name() || config.OpenAIClient != nil,
+			"embedder":   configuredEmbedder().Name(),
+			"circuit":    providerBreaker.status(),
+		},
+		"index": gin.H{
+			"loaded":     len(idx.Items) > 0,
+			"items":      len(idx.Items),
+			"version":    idx.Meta.Version,
+			"embedder":   idx.Meta.Embedder,
+			"dimensions": idx.Meta.Dimensions,
+			"lastUpdate": idx.Meta.LastUpdate,
+			"migrating":  indexMigrationRunning(),
+		},
+		"snapshots": snapshots,
+	})
+}
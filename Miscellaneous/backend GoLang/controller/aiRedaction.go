@@ -0,0 +1,308 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"example.com/portfolio-backend/config"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RedactionPolicy configures what is scrubbed from context snapshots and chunks before they are
+// embedded. It is stored as a single document in the "redactionPolicy" collection of the AI DB.
+type RedactionPolicy struct {
+	DenyFields  []string  `bson:"denyFields" json:"denyFields"`   // field names dropped wherever they are whole words of a key, see deniesField
+	Detectors   []string  `bson:"detectors" json:"detectors"`     // enabled value detectors, see redactionDetectors
+	AllowValues []string  `bson:"allowValues" json:"allowValues"` // matches kept verbatim (e.g. the public contact email)
+	UpdatedAt   time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+// defaultRedactionPolicy returns the built-in policy used until one is stored.
+func defaultRedactionPolicy() *RedactionPolicy {
+	names := make([]string, 0, len(redactionDetectors))
+	for _, d := range redactionDetectors {
+		names = append(names, d.Name)
+	}
+	return &RedactionPolicy{
+		DenyFields: []string{"password", "passwd", "secret", "token", "apikey", "api_key", "privatekey", "private_key", "ssn"},
+		Detectors:  names,
+	}
+}
+
+// redactionDetector finds one kind of sensitive value. With KeepPrefix the first submatch
+// (e.g. "API_KEY=") is kept and only the value is replaced.
+type redactionDetector struct {
+	Name       string
+	Re         *regexp.Regexp
+	KeepPrefix bool
+}
+
+// redactionDetectors run in order, so URLs are handled before the hosts and IPs inside them.
+var redactionDetectors = []redactionDetector{
+	{Name: "private-key", Re: regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)},
+	{Name: "token", Re: regexp.MustCompile(`\b(AKIA[0-9A-Z]{16}|gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{20,}|sk-(proj-)?[A-Za-z0-9_-]{20,}|xox[baprs]-[A-Za-z0-9-]{10,}|AIza[0-9A-Za-z_-]{35}|eyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,})\b`)},
+	{Name: "secret-assignment", Re: regexp.MustCompile(`(?i)([A-Za-z0-9_]*(?:api[_-]?key|secret(?:[_-]?(?:access[_-]?)?key)?|access[_-]?token|auth[_-]?token|password|passwd)["']?\s*[:=]\s*)["']?[^\s"'.,;]{6,}["']?`), KeepPrefix: true},
+	{Name: "internal-url", Re: regexp.MustCompile(`(?i)\bhttps?://(localhost|[a-z0-9.-]+\.(internal|local|lan|corp|intranet))(:\d+)?([/?#][^\s)"'<>]*|\b)`)},
+	{Name: "email", Re: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)},
+	{Name: "private-ip", Re: regexp.MustCompile(`\b(10\.\d{1,3}\.\d{1,3}\.\d{1,3}|192\.168\.\d{1,3}\.\d{1,3}|172\.(1[6-9]|2\d|3[01])\.\d{1,3}\.\d{1,3}|127\.\d{1,3}\.\d{1,3}\.\d{1,3})\b`)},
+	// Separators are required so bare 10-digit numbers (timestamps, IDs) are left alone
+	{Name: "phone", Re: regexp.MustCompile(`(\+\d{1,3}[\s.-]?)?(\(\d{3}\)\s?|\b\d{3}[\s.-])\d{3}[\s.-]\d{4}\b`)},
+}
+
+// RedactionReport summarises what a redaction pass removed; it is stored with each snapshot.
+type RedactionReport struct {
+	Total        int            `bson:"total" json:"total"`
+	ByDetector   map[string]int `bson:"byDetector,omitempty" json:"byDetector,omitempty"`
+	DeniedFields map[string]int `bson:"deniedFields,omitempty" json:"deniedFields,omitempty"`
+}
+
+func newRedactionReport() *RedactionReport {
+	return &RedactionReport{ByDetector: map[string]int{}, DeniedFields: map[string]int{}}
+}
+
+// Active redaction policy
+var redactionState = struct {
+	sync.RWMutex
+	policy *RedactionPolicy
+}{}
+
+// currentRedactionPolicy returns the active policy (the built-in default until one is loaded).
+func currentRedactionPolicy() *RedactionPolicy {
+	redactionState.RLock()
+	defer redactionState.RUnlock()
+	if redactionState.policy == nil {
+		return defaultRedactionPolicy()
+	}
+	return redactionState.policy
+}
+
+// validate checks that every enabled detector exists and field names are lowercase.
+func (p *RedactionPolicy) validate() []string {
+	var errs []string
+	for _, name := range p.Detectors {
+		known := false
+		for _, d := range redactionDetectors {
+			known = known || d.Name == name
+		}
+		if !known {
+			errs = append(errs, fmt.Sprintf("detectors: unknown detector %q", name))
+		}
+	}
+	for _, f := range p.DenyFields {
+		if strings.TrimSpace(f) == "" || f != strings.ToLower(f) {
+			errs = append(errs, fmt.Sprintf("denyFields: %q must be non-empty lowercase", f))
+		}
+	}
+	return errs
+}
+
+// reloadRedactionPolicy loads the stored policy, keeping the previous one if it is missing or invalid.
+func reloadRedactionPolicy(ctx context.Context) {
+	p := defaultRedactionPolicy()
+	if err := config.GetDBAI().Collection("redactionPolicy").FindOne(ctx, bson.M{"_id": "redactionPolicy"}).Decode(p); err != nil {
+		return
+	}
+	if errs := p.validate(); len(errs) > 0 {
+		log.Printf("Invalid redaction policy, keeping previous: %s", strings.Join(errs, "; "))
+		return
+	}
+	redactionState.Lock()
+	redactionState.policy = p
+	redactionState.Unlock()
+}
+
+// deniesField reports whether a field must be dropped from snapshots and chunks. Keys are split
+// into words on separators and camelCase, and a deny entry matches a run of consecutive words:
+// "token" matches accessToken and github_token but not tokenizer, and "apikey" matches apiKey.
+func (p *RedactionPolicy) deniesField(key string) bool {
+	words := fieldWords(key)
+	for _, f := range p.DenyFields {
+		entry := strings.Join(fieldWords(f), "")
+		if entry == "" {
+			continue
+		}
+		for i := range words {
+			run := ""
+			for _, w := range words[i:] {
+				if run += w; len(run) >= len(entry) {
+					break
+				}
+			}
+			if run == entry {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// fieldWords splits a field name into lowercase words on non-alphanumeric characters and
+// camelCase boundaries ("APIKey" is api, key).
+func fieldWords(name string) []string {
+	var words []string
+	var word []rune
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, strings.ToLower(string(word)))
+			word = word[:0]
+		}
+	}
+	runes := []rune(name)
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			flush()
+			continue
+		}
+		if unicode.IsUpper(r) && i > 0 {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				flush()
+			}
+		}
+		word = append(word, r)
+	}
+	flush()
+	return words
+}
+
+// redactText replaces every sensitive value found by the enabled detectors.
+func (p *RedactionPolicy) redactText(text string, report *RedactionReport) string {
+	for _, d := range redactionDetectors {
+		if !containsString(p.Detectors, d.Name) {
+			continue
+		}
+		text = d.Re.ReplaceAllStringFunc(text, func(match string) string {
+			for _, allowed := range p.AllowValues {
+				if strings.EqualFold(strings.TrimSpace(allowed), match) {
+					return match
+				}
+			}
+			report.Total++
+			report.ByDetector[d.Name]++
+			placeholder := "[REDACTED:" + d.Name + "]"
+			if d.KeepPrefix {
+				return d.Re.FindStringSubmatch(match)[1] + placeholder
+			}
+			return placeholder
+		})
+	}
+	return text
+}
+
+// redactValue walks a snapshot value (plain JSON or decoded BSON), dropping denied fields and
+// redacting strings in place.
+func (p *RedactionPolicy) redactValue(value interface{}, report *RedactionReport) interface{} {
+	redactMap := func(m map[string]interface{}) {
+		for key, elem := range m {
+			if p.deniesField(key) {
+				delete(m, key)
+				report.Total++
+				report.DeniedFields[key]++
+				continue
+			}
+			m[key] = p.redactValue(elem, report)
+		}
+	}
+	switch v := value.(type) {
+	case string:
+		return p.redactText(v, report)
+	case map[string]interface{}:
+		redactMap(v)
+	case bson.M:
+		redactMap(v)
+	case []interface{}:
+		for i := range v {
+			v[i] = p.redactValue(v[i], report)
+		}
+	case primitive.A:
+		for i := range v {
+			v[i] = p.redactValue(v[i], report)
+		}
+	case []bson.M:
+		for _, m := range v {
+			redactMap(m)
+		}
+	case []map[string]interface{}:
+		for _, m := range v {
+			redactMap(m)
+		}
+	}
+	return value
+}
+
+// redactChunks scrubs chunk texts that were built from snapshots taken before redaction ran
+// (or under an older policy).
+func redactChunks(chunks []MemoryItem) {
+	policy := currentRedactionPolicy()
+	report := newRedactionReport()
+	for i := range chunks {
+		chunks[i].Text = policy.redactText(chunks[i].Text, report)
+	}
+	if report.Total > 0 {
+		log.Printf("🔒 Redacted %d values from chunks %s", report.Total, report.summary())
+	}
+}
+
+// summary formats the per-detector counts for logs.
+func (r *RedactionReport) summary() string {
+	var parts []string
+	for name, n := range r.ByDetector {
+		parts = append(parts, fmt.Sprintf("%s=%d", name, n))
+	}
+	for name, n := range r.DeniedFields {
+		parts = append(parts, fmt.Sprintf("field:%s=%d", name, n))
+	}
+	sort.Strings(parts)
+	return "(" + strings.Join(parts, ", ") + ")"
+}
+
+// -- Admin handlers --
+
+// GetRedactionPolicy returns the active redaction policy and the available detectors.
+func GetRedactionPolicy(c *gin.Context) {
+	names := make([]string, 0, len(redactionDetectors))
+	for _, d := range redactionDetectors {
+		names = append(names, d.Name)
+	}
+	c.JSON(http.StatusOK, gin.H{"policy": currentRedactionPolicy(), "availableDetectors": names})
+}
+
+// PutRedactionPolicy validates, stores and activates a redaction policy. It applies from the
+// next snapshot refresh or index rebuild.
+func PutRedactionPolicy(c *gin.Context) {
+	p := defaultRedactionPolicy()
+	if err := c.BindJSON(p); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid redaction policy data"})
+		return
+	}
+	if errs := p.validate(); len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid redaction policy", "errors": errs})
+		return
+	}
+	p.UpdatedAt = time.Now()
+	_, err := config.GetDBAI().Collection("redactionPolicy").UpdateOne(c.Request.Context(),
+		bson.M{"_id": "redactionPolicy"},
+		bson.M{"$set": p},
+		optionsUpsert(),
+	)
+	if err != nil {
+		log.Println("Error saving redaction policy:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving redaction policy"})
+		return
+	}
+	redactionState.Lock()
+	redactionState.policy = p
+	redactionState.Unlock()
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Redaction policy saved.", "policy": p})
+}
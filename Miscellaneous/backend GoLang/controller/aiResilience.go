@@ -0,0 +1,195 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"example.com/portfolio-backend/config"
+	"github.com/gin-gonic/gin"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Provider call retry and circuit breaker settings
+var (
+	retryMaxAttempts = config.EnvInt("AI_RETRY_ATTEMPTS", 3)
+	retryBaseDelay   = config.EnvDuration("AI_RETRY_BASE_DELAY", 500*time.Millisecond)
+	retryMaxDelay    = config.EnvDuration("AI_RETRY_MAX_DELAY", 10*time.Second)
+	breakerThreshold = config.EnvInt("AI_BREAKER_FAILURES", 5)
+	breakerCooldown  = config.EnvDuration("AI_BREAKER_COOLDOWN", 30*time.Second)
+)
+
+// errCircuitOpen is returned without calling the provider while the circuit breaker is open.
+var errCircuitOpen = errors.New("AI provider circuit breaker is open")
+
+// retryable reports whether a failed provider call may succeed if repeated: rate limits, server
+// errors, network failures and attempt timeouts. Other 4xx errors and exhausted quotas won't.
+func retryable(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil || errors.Is(err, errCircuitOpen) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return true
+	}
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		if apiErr.Type == "insufficient_quota" {
+			return false
+		}
+		return retryableStatus(apiErr.HTTPStatusCode)
+	}
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return retryableStatus(reqErr.HTTPStatusCode)
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// retryableStatus reports whether an HTTP status is worth retrying.
+func retryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// retryDelay is the wait before retry n (from 1): exponential backoff with jitter, or the
+// provider's Retry-After when it sent one.
+func retryDelay(n int, hint *config.RetryHint) time.Duration {
+	if hint.After > 0 {
+		return hint.After
+	}
+	delay := retryBaseDelay << (n - 1)
+	if delay > retryMaxDelay || delay <= 0 {
+		delay = retryMaxDelay
+	}
+	// Equal jitter keeps at least half the backoff while spreading concurrent retries
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// callProvider runs one provider call with a per-attempt timeout, retrying retryable failures
+// with backoff. It fails fast while the circuit breaker is open, and gives up when the wait
+// would exceed retryMaxDelay or outlive ctx.
+func callProvider(ctx context.Context, timeout time.Duration, call func(context.Context) error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err := providerBreaker.allow(); err != nil {
+			return err
+		}
+		hint := &config.RetryHint{}
+		attemptCtx, cancel := config.WithRetryHint(ctx, hint), context.CancelFunc(func() {})
+		if timeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(attemptCtx, timeout)
+		}
+		err = call(attemptCtx)
+		cancel()
+		providerBreaker.record(ctx, err)
+		if err == nil || !retryable(ctx, err) || attempt >= retryMaxAttempts {
+			return err
+		}
+		delay := retryDelay(attempt, hint)
+		if delay > retryMaxDelay {
+			return err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return err
+		}
+		log.Printf("AI provider call failed (%v), retrying in %s", err, delay.Round(time.Millisecond))
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// -- Circuit breaker --
+
+// Circuit breaker states
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half-open"
+)
+
+// circuitBreaker opens after breakerThreshold consecutive retryable failures, so callers fall
+// back to degraded answers instead of waiting on an unhealthy provider. After the cooldown one
+// probe call is let through; its success closes the circuit, its failure reopens it.
+type circuitBreaker struct {
+	sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+	trips    int
+}
+
+// providerBreaker guards every call to the AI provider.
+var providerBreaker = &circuitBreaker{state: breakerClosed}
+
+// allow returns errCircuitOpen when the call must not reach the provider.
+func (b *circuitBreaker) allow() error {
+	if breakerThreshold <= 0 {
+		return nil
+	}
+	b.Lock()
+	defer b.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < breakerCooldown {
+			return errCircuitOpen
+		}
+		b.state, b.probing = breakerHalfOpen, true
+		return nil
+	case breakerHalfOpen:
+		if b.probing {
+			return errCircuitOpen
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// record updates the breaker with the outcome of a call. Only failures that point at the
+// provider count; a bad request means it is reachable, and cancelled callers say nothing.
+func (b *circuitBreaker) record(ctx context.Context, err error) {
+	if breakerThreshold <= 0 || errors.Is(err, errCircuitOpen) {
+		return
+	}
+	b.Lock()
+	defer b.Unlock()
+	b.probing = false
+	if err != nil && ctx.Err() != nil {
+		return
+	}
+	if !retryable(ctx, err) {
+		if b.state != breakerClosed {
+			log.Println("✅ AI provider recovered, closing circuit breaker")
+		}
+		b.state, b.failures = breakerClosed, 0
+		return
+	}
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= breakerThreshold {
+		if b.state == breakerClosed {
+			b.trips++
+		}
+		b.state, b.openedAt = breakerOpen, time.Now()
+		log.Printf("⚠️ AI provider unhealthy after %d failures (%v), opening circuit breaker for %s", b.failures, err, breakerCooldown)
+	}
+}
+
+// status describes the breaker, for /readyz.
+func (b *circuitBreaker) status() gin.H {
+	b.Lock()
+	defer b.Unlock()
+	s := gin.H{"state": b.state, "failures": b.failures, "trips": b.trips}
+	if b.state == breakerOpen {
+		s["retryAt"] = b.openedAt.Add(breakerCooldown)
+	}
+	return s
+}
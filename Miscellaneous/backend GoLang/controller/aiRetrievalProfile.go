@@ -0,0 +1,338 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/portfolio-backend/config"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// RetrievalProfile holds every tunable of the retrieval pipeline. Profiles are stored in the
+// "retrievalProfiles" collection of the AI DB, keyed by name; one of them is active at a time.
+type RetrievalProfile struct {
+	Name                string             `bson:"_id" json:"name"`
+	CategoryWeights     map[string]float64 `bson:"categoryWeights" json:"categoryWeights"`
+	QueryBoost          map[string]float64 `bson:"queryBoost" json:"queryBoost"`
+	ResumeTerms         []string           `bson:"resumeTerms" json:"resumeTerms"`
+	IntentThreshold     float64            `bson:"intentThreshold" json:"intentThreshold"`         // minimum prototype similarity for an intent
+	IntentMinConfidence float64            `bson:"intentMinConfidence" json:"intentMinConfidence"` // minimum softmax confidence for an intent
+	TopK                map[string]int     `bson:"topK" json:"topK"`
+	MaxCounts           map[string]int     `bson:"maxCounts" json:"maxCounts"`
+	MinAlloc            map[string]int     `bson:"minAlloc" json:"minAlloc"`
+	TotalBudget         int                `bson:"totalBudget" json:"totalBudget"`
+	ContextCharLimit    int                `bson:"contextCharLimit" json:"contextCharLimit"`
+	UpdatedAt           time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
+
+// retrievalCategories are the memory index categories a profile may configure.
+var retrievalCategories = []string{"db", "resume", "github"}
+
+// defaultRetrievalProfileName is used when the AI DB has no active profile.
+const defaultRetrievalProfileName = "default"
+
+// Active retrieval profile, swapped atomically on reload
+var retrievalProfileState = struct {
+	sync.RWMutex
+	active *RetrievalProfile
+}{}
+
+// defaultRetrievalProfile returns the built-in profile made from the package defaults.
+func defaultRetrievalProfile() *RetrievalProfile {
+	return &RetrievalProfile{
+		Name:                defaultRetrievalProfileName,
+		CategoryWeights:     copyFloatMap(categoryWeights),
+		QueryBoost:          copyFloatMap(queryBoost),
+		ResumeTerms:         append([]string{}, resumeTerms...),
+		IntentThreshold:     0.3,
+		IntentMinConfidence: 0.15,
+		TopK:                map[string]int{"db": 10, "github": 5, "resume": 3},
+		MaxCounts:           map[string]int{"db": 6, "resume": 3, "github": 3},
+		MinAlloc:            map[string]int{"db": 1, "resume": 1, "github": 0},
+		TotalBudget:         12,
+		ContextCharLimit:    8000,
+	}
+}
+
+// currentRetrievalProfile returns the active profile (the built-in default until one is loaded).
+func currentRetrievalProfile() *RetrievalProfile {
+	retrievalProfileState.RLock()
+	p := retrievalProfileState.active
+	retrievalProfileState.RUnlock()
+	if p == nil {
+		return defaultRetrievalProfile()
+	}
+	return p
+}
+
+// setActiveRetrievalProfile swaps the in-memory active profile.
+func setActiveRetrievalProfile(p *RetrievalProfile) {
+	retrievalProfileState.Lock()
+	retrievalProfileState.active = p
+	retrievalProfileState.Unlock()
+}
+
+// validate checks a profile for unknown categories and out-of-range values.
+func (p *RetrievalProfile) validate() []string {
+	var errs []string
+	checkFloats := func(field string, m map[string]float64, max float64) {
+		if len(m) == 0 {
+			errs = append(errs, field+" is required")
+		}
+		for cat, v := range m {
+			if !containsString(retrievalCategories, cat) {
+				errs = append(errs, fmt.Sprintf("%s: unknown category %q", field, cat))
+			}
+			if v < 0 || v > max {
+				errs = append(errs, fmt.Sprintf("%s.%s must be between 0 and %g", field, cat, max))
+			}
+		}
+	}
+	checkInts := func(field string, m map[string]int, max int) {
+		if len(m) == 0 {
+			errs = append(errs, field+" is required")
+		}
+		for cat, v := range m {
+			if !containsString(retrievalCategories, cat) {
+				errs = append(errs, fmt.Sprintf("%s: unknown category %q", field, cat))
+			}
+			if v < 0 || v > max {
+				errs = append(errs, fmt.Sprintf("%s.%s must be between 0 and %d", field, cat, max))
+			}
+		}
+	}
+	checkTerms := func(field string, terms []string) {
+		if len(terms) == 0 {
+			errs = append(errs, field+" is required")
+		}
+		for _, t := range terms {
+			if strings.TrimSpace(t) == "" || t != strings.ToLower(t) {
+				errs = append(errs, fmt.Sprintf("%s: term %q must be non-empty lowercase", field, t))
+			}
+		}
+	}
+	if strings.TrimSpace(p.Name) == "" {
+		errs = append(errs, "name is required")
+	}
+	checkFloats("categoryWeights", p.CategoryWeights, 10)
+	checkFloats("queryBoost", p.QueryBoost, 1)
+	checkTerms("resumeTerms", p.ResumeTerms)
+	checkInts("topK", p.TopK, 100)
+	checkInts("maxCounts", p.MaxCounts, 50)
+	checkInts("minAlloc", p.MinAlloc, 50)
+	for cat, min := range p.MinAlloc {
+		if min > p.MaxCounts[cat] {
+			errs = append(errs, fmt.Sprintf("minAlloc.%s must not exceed maxCounts.%s", cat, cat))
+		}
+	}
+	if p.IntentThreshold < -1 || p.IntentThreshold > 1 {
+		errs = append(errs, "intentThreshold must be between -1 and 1")
+	}
+	if p.IntentMinConfidence < 0 || p.IntentMinConfidence > 1 {
+		errs = append(errs, "intentMinConfidence must be between 0 and 1")
+	}
+	if p.TotalBudget < 1 || p.TotalBudget > 50 {
+		errs = append(errs, "totalBudget must be between 1 and 50")
+	}
+	if p.ContextCharLimit < 500 || p.ContextCharLimit > 32000 {
+		errs = append(errs, "contextCharLimit must be between 500 and 32000")
+	}
+	return errs
+}
+
+// loadRetrievalProfile reads a named profile from the AI DB.
+func loadRetrievalProfile(ctx context.Context, name string) (*RetrievalProfile, error) {
+	var p RetrievalProfile
+	if err := config.GetDBAI().Collection("retrievalProfiles").FindOne(ctx, bson.M{"_id": name}).Decode(&p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// activeRetrievalProfileName reads the name of the active profile from retrievalProfileMeta.
+func activeRetrievalProfileName(ctx context.Context) string {
+	var doc struct {
+		Active string `bson:"active"`
+	}
+	_ = config.GetDBAI().Collection("retrievalProfileMeta").FindOne(ctx, bson.M{"_id": "retrievalProfileMeta"}).Decode(&doc)
+	if doc.Active == "" {
+		return defaultRetrievalProfileName
+	}
+	return doc.Active
+}
+
+// reloadRetrievalProfile loads the active profile from the AI DB, seeding the default profile
+// on first run. Invalid or missing profiles keep the current one in place.
+func reloadRetrievalProfile(ctx context.Context) {
+	name := activeRetrievalProfileName(ctx)
+	p, err := loadRetrievalProfile(ctx, name)
+	if err != nil && name == defaultRetrievalProfileName {
+		p = defaultRetrievalProfile()
+		if err := saveRetrievalProfile(ctx, p); err != nil {
+			log.Println("Error seeding default retrieval profile:", err)
+		}
+	} else if err != nil {
+		log.Printf("Retrieval profile %q not found, keeping current profile: %v", name, err)
+		return
+	}
+	if errs := p.validate(); len(errs) > 0 {
+		log.Printf("Retrieval profile %q is invalid, keeping current profile: %s", name, strings.Join(errs, "; "))
+		return
+	}
+	retrievalProfileState.RLock()
+	prev := retrievalProfileState.active
+	retrievalProfileState.RUnlock()
+	setActiveRetrievalProfile(p)
+	if prev == nil || prev.Name != p.Name || !prev.UpdatedAt.Equal(p.UpdatedAt) {
+		log.Printf("✅ Retrieval profile %q loaded", p.Name)
+	}
+}
+
+// saveRetrievalProfile upserts a profile into the AI DB.
+func saveRetrievalProfile(ctx context.Context, p *RetrievalProfile) error {
+	p.UpdatedAt = time.Now()
+	raw, err := bson.Marshal(p)
+	if err != nil {
+		return err
+	}
+	var set bson.M
+	if err := bson.Unmarshal(raw, &set); err != nil {
+		return err
+	}
+	delete(set, "_id") // _id is immutable, it only goes in the filter
+	_, err = config.GetDBAI().Collection("retrievalProfiles").UpdateOne(ctx,
+		bson.M{"_id": p.Name},
+		bson.M{"$set": set},
+		optionsUpsert(),
+	)
+	return err
+}
+
+// watchRetrievalProfiles periodically reloads the active profile so edits made through another
+// instance are picked up without a restart. Only the first call starts the watcher; every call
+// returns immediately.
+func watchRetrievalProfiles() {
+	retrievalProfileWatchOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(time.Minute)
+			for range ticker.C {
+				reloadRetrievalProfile(context.Background())
+			}
+		}()
+	})
+}
+
+var retrievalProfileWatchOnce sync.Once
+
+// LoadRetrievalProfileFile reads and validates a profile from a JSON file (used by the eval CLI).
+func LoadRetrievalProfileFile(path string) (*RetrievalProfile, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p := defaultRetrievalProfile()
+	if err := json.Unmarshal(raw, p); err != nil {
+		return nil, fmt.Errorf("invalid retrieval profile %s: %w", path, err)
+	}
+	if errs := p.validate(); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid retrieval profile %s: %s", path, strings.Join(errs, "; "))
+	}
+	return p, nil
+}
+
+// -- Admin handlers --
+
+// GetRetrievalProfiles lists all stored profiles and the active profile name.
+func GetRetrievalProfiles(c *gin.Context) {
+	ctx := c.Request.Context()
+	cur, err := config.GetDBAI().Collection("retrievalProfiles").Find(ctx, bson.M{})
+	if err != nil {
+		log.Println("Error fetching retrieval profiles:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching retrieval profiles"})
+		return
+	}
+	var profiles []RetrievalProfile
+	if err := cur.All(ctx, &profiles); err != nil {
+		log.Println("Error decoding retrieval profiles:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching retrieval profiles"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"active": currentRetrievalProfile().Name, "profiles": profiles})
+}
+
+// GetRetrievalProfile returns one profile by name.
+func GetRetrievalProfile(c *gin.Context) {
+	p, err := loadRetrievalProfile(c.Request.Context(), c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Retrieval profile not found"})
+		return
+	}
+	c.JSON(http.StatusOK, p)
+}
+
+// PutRetrievalProfile validates and stores a profile; if it is the active one it is hot-reloaded.
+func PutRetrievalProfile(c *gin.Context) {
+	ctx := c.Request.Context()
+	var p RetrievalProfile
+	if err := c.BindJSON(&p); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid retrieval profile data"})
+		return
+	}
+	p.Name = c.Param("name")
+	if errs := p.validate(); len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid retrieval profile", "errors": errs})
+		return
+	}
+	if err := saveRetrievalProfile(ctx, &p); err != nil {
+		log.Println("Error saving retrieval profile:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving retrieval profile"})
+		return
+	}
+	if currentRetrievalProfile().Name == p.Name {
+		reloadRetrievalProfile(ctx)
+		// Cached answers were retrieved with the previous settings of the active profile
+		if _, err := purgeAnswerCache(ctx); err != nil {
+			log.Println("Error purging answer cache:", err)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Retrieval profile saved.", "profile": p})
+}
+
+// ActivateRetrievalProfile makes a stored profile the active one.
+func ActivateRetrievalProfile(c *gin.Context) {
+	ctx := c.Request.Context()
+	name := c.Param("name")
+	if _, err := loadRetrievalProfile(ctx, name); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Retrieval profile not found"})
+		return
+	}
+	_, err := config.GetDBAI().Collection("retrievalProfileMeta").UpdateOne(ctx,
+		bson.M{"_id": "retrievalProfileMeta"},
+		bson.M{"$set": bson.M{"active": name}},
+		optionsUpsert(),
+	)
+	if err != nil {
+		log.Println("Error activating retrieval profile:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error activating retrieval profile"})
+		return
+	}
+	reloadRetrievalProfile(ctx)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Retrieval profile activated.", "active": currentRetrievalProfile().Name})
+}
+
+// copyFloatMap returns a shallow copy of m.
+func copyFloatMap(m map[string]float64) map[string]float64 {
+	out := make(map[string]float64, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,435 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/portfolio-backend/config"
+	openai "github.com/sashabaranov/go-openai"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// toolMaxSteps caps the model/tool round trips of one answer in tool mode
+var toolMaxSteps = config.EnvInt("AI_TOOL_MAX_STEPS", 5)
+
+// toolTraceResultMax is the number of runes of a tool result kept in the response trace.
+const toolTraceResultMax = 2000
+
+// ToolCallRecord is one tool invocation made while answering, returned in the response trace.
+type ToolCallRecord struct {
+	Step       int    `json:"step"`
+	Tool       string `json:"tool"`
+	Arguments  string `json:"arguments"`
+	Result     string `json:"result,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+// portfolioCollection maps a tool-facing collection name to its table and field prefix
+// (projectTable uses projectTitle, projectLink, projectTimeline, ...).
+type portfolioCollection struct {
+	Table  string
+	Prefix string
+}
+
+var portfolioCollections = map[string]portfolioCollection{
+	"projects":        {"projectTable", "project"},
+	"experiences":     {"experienceTable", "experience"},
+	"involvements":    {"involvementTable", "involvement"},
+	"honors":          {"honorsExperienceTable", "honorsExperience"},
+	"yearInReview":    {"yearInReviewTable", "yearInReview"},
+	"skillCategories": {"skillsCollection", ""},
+	"skills":          {"skillsTable", "skill"},
+}
+
+// portfolioCollectionNames returns the tool-facing collection names in a stable order.
+func portfolioCollectionNames() []string {
+	names := make([]string, 0, len(portfolioCollections))
+	for name := range portfolioCollections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// chatTool is a typed function the chat model may call in tool mode.
+type chatTool struct {
+	Def openai.FunctionDefinition
+	Run func(ctx context.Context, args json.RawMessage) (interface{}, error)
+}
+
+// chatTools is the tool catalogue offered to the model.
+var chatTools = []chatTool{
+	{
+		Def: openai.FunctionDefinition{
+			Name:        "list_projects_by_skill",
+			Description: "List projects whose title, tagline or description mention a skill, language or technology (e.g. Go, React, MongoDB).",
+			Parameters: map[string]interface{}{
+				"type":                 "object",
+				"properties":           map[string]interface{}{"skill": map[string]interface{}{"type": "string"}},
+				"required":             []string{"skill"},
+				"additionalProperties": false,
+			},
+		},
+		Run: toolListProjectsBySkill,
+	},
+	{
+		Def: openai.FunctionDefinition{
+			Name:        "get_project_by_link",
+			Description: "Get the full details of one project by its projectLink slug.",
+			Parameters: map[string]interface{}{
+				"type":                 "object",
+				"properties":           map[string]interface{}{"link": map[string]interface{}{"type": "string"}},
+				"required":             []string{"link"},
+				"additionalProperties": false,
+			},
+		},
+		Run: toolGetProjectByLink,
+	},
+	{
+		Def: openai.FunctionDefinition{
+			Name:        "count_items",
+			Description: "Count portfolio items per collection, optionally only those whose timeline covers a year. Omit collection to count every collection.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"collection": map[string]interface{}{"type": "string", "enum": portfolioCollectionNames()},
+					"year":       map[string]interface{}{"type": "integer"},
+				},
+				"additionalProperties": false,
+			},
+		},
+		Run: toolCountItems,
+	},
+	{
+		Def: openai.FunctionDefinition{
+			Name:        "list_items",
+			Description: "List the titles, timelines and taglines of a collection, optionally only those whose timeline covers a year.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"collection": map[string]interface{}{"type": "string", "enum": portfolioCollectionNames()},
+					"year":       map[string]interface{}{"type": "integer"},
+				},
+				"required":             []string{"collection"},
+				"additionalProperties": false,
+			},
+		},
+		Run: toolListItems,
+	},
+	{
+		Def: openai.FunctionDefinition{
+			Name:        "list_skills",
+			Description: "List skills with their proficiency, grouped by skill category; optionally only categories whose title contains the given text.",
+			Parameters: map[string]interface{}{
+				"type":                 "object",
+				"properties":           map[string]interface{}{"category": map[string]interface{}{"type": "string"}},
+				"additionalProperties": false,
+			},
+		},
+		Run: toolListSkills,
+	},
+}
+
+// findChatTool looks a tool up by name.
+func findChatTool(name string) *chatTool {
+	for i := range chatTools {
+		if chatTools[i].Def.Name == name {
+			return &chatTools[i]
+		}
+	}
+	return nil
+}
+
+// -- Tool implementations --
+
+// toolItemSummary is the compact view of a portfolio item returned by list tools.
+func toolItemSummary(doc bson.M, prefix string) map[string]interface{} {
+	field := func(suffix string) interface{} {
+		if prefix == "" {
+			return doc[strings.ToLower(suffix[:1])+suffix[1:]]
+		}
+		return doc[prefix+suffix]
+	}
+	out := map[string]interface{}{}
+	for _, suffix := range []string{"Title", "SubTitle", "Timeline", "Tagline", "Link"} {
+		if v := field(suffix); v != nil && v != "" {
+			out[strings.ToLower(suffix[:1])+suffix[1:]] = v
+		}
+	}
+	return out
+}
+
+// timelineYears matches the years in a timeline such as "August 2022 - Present".
+var timelineYears = regexp.MustCompile(`\b(19|20)\d{2}\b|(?i)\bpresent\b`)
+
+// timelineCovers reports whether a timeline string spans the given year.
+func timelineCovers(timeline string, year int) bool {
+	var years []int
+	for _, m := range timelineYears.FindAllString(timeline, -1) {
+		if y, err := strconv.Atoi(m); err == nil {
+			years = append(years, y)
+		} else {
+			years = append(years, time.Now().Year())
+		}
+	}
+	if len(years) == 0 {
+		return false
+	}
+	sort.Ints(years)
+	return year >= years[0] && year <= years[len(years)-1]
+}
+
+// toolCollectionDocs loads a collection by its tool-facing name, optionally filtered by year.
+func toolCollectionDocs(ctx context.Context, name string, year int) ([]bson.M, portfolioCollection, error) {
+	col, ok := portfolioCollections[name]
+	if !ok {
+		return nil, col, fmt.Errorf("unknown collection %q, expected one of %s", name, strings.Join(portfolioCollectionNames(), ", "))
+	}
+	docs, err := getCachedAllDocuments(ctx, col.Table)
+	if err != nil {
+		return nil, col, err
+	}
+	if year == 0 {
+		return docs, col, nil
+	}
+	var filtered []bson.M
+	for _, doc := range docs {
+		if timeline, _ := doc[col.Prefix+"Timeline"].(string); timelineCovers(timeline, year) {
+			filtered = append(filtered, doc)
+		}
+	}
+	return filtered, col, nil
+}
+
+func toolListProjectsBySkill(ctx context.Context, raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		Skill string `json:"skill"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil || strings.TrimSpace(args.Skill) == "" {
+		return nil, fmt.Errorf("skill is required")
+	}
+	docs, err := getCachedAllDocuments(ctx, "projectTable")
+	if err != nil {
+		return nil, err
+	}
+	// Word match that also works for names like "C++" or ".NET"
+	re := regexp.MustCompile(`(?i)(^|[^A-Za-z0-9])` + regexp.QuoteMeta(strings.TrimSpace(args.Skill)) + `($|[^A-Za-z0-9])`)
+	matches := []map[string]interface{}{}
+	for _, doc := range docs {
+		for _, suffix := range []string{"Title", "SubTitle", "Tagline", "Paragraphs"} {
+			if re.MatchString(fmt.Sprintf("%v", doc["project"+suffix])) {
+				summary := toolItemSummary(doc, "project")
+				summary["matchedIn"] = strings.ToLower(suffix[:1]) + suffix[1:]
+				matches = append(matches, summary)
+				break
+			}
+		}
+	}
+	return map[string]interface{}{"skill": args.Skill, "count": len(matches), "projects": matches}, nil
+}
+
+func toolGetProjectByLink(ctx context.Context, raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		Link string `json:"link"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil || strings.TrimSpace(args.Link) == "" {
+		return nil, fmt.Errorf("link is required")
+	}
+	project, err := getDocumentByLink(ctx, "projectTable", "projectLink", strings.TrimSpace(args.Link))
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("no project with link %q", args.Link)
+	} else if err != nil {
+		return nil, err
+	}
+	// Same fields the context snapshot leaves out
+	for _, k := range []string{"_id", "projectURLs", "projectImages", "likesCount", "deleted"} {
+		delete(project, k)
+	}
+	return project, nil
+}
+
+func toolCountItems(ctx context.Context, raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		Collection string `json:"collection"`
+		Year       int    `json:"year"`
+	}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &args); err != nil {
+			return nil, fmt.Errorf("invalid arguments: %v", err)
+		}
+	}
+	names := portfolioCollectionNames()
+	if args.Collection != "" {
+		names = []string{args.Collection}
+	}
+	counts := map[string]int{}
+	for _, name := range names {
+		docs, _, err := toolCollectionDocs(ctx, name, args.Year)
+		if err != nil {
+			return nil, err
+		}
+		counts[name] = len(docs)
+	}
+	out := map[string]interface{}{"counts": counts}
+	if args.Year != 0 {
+		out["year"] = args.Year
+	}
+	return out, nil
+}
+
+func toolListItems(ctx context.Context, raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		Collection string `json:"collection"`
+		Year       int    `json:"year"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil || args.Collection == "" {
+		return nil, fmt.Errorf("collection is required")
+	}
+	docs, col, err := toolCollectionDocs(ctx, args.Collection, args.Year)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]map[string]interface{}, 0, len(docs))
+	for _, doc := range docs {
+		items = append(items, toolItemSummary(doc, col.Prefix))
+	}
+	return map[string]interface{}{"collection": args.Collection, "count": len(items), "items": items}, nil
+}
+
+func toolListSkills(ctx context.Context, raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		Category string `json:"category"`
+	}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &args); err != nil {
+			return nil, fmt.Errorf("invalid arguments: %v", err)
+		}
+	}
+	docs, err := getCachedAllDocuments(ctx, "skillsCollection")
+	if err != nil {
+		return nil, err
+	}
+	categories := []map[string]interface{}{}
+	for _, doc := range docs {
+		title, _ := doc["title"].(string)
+		if args.Category != "" && !strings.Contains(strings.ToLower(title), strings.ToLower(args.Category)) {
+			continue
+		}
+		var skills []map[string]interface{}
+		if list, ok := doc["skills"].(bson.A); ok {
+			for _, s := range list {
+				if m, ok := s.(bson.M); ok {
+					skills = append(skills, map[string]interface{}{"name": m["name"], "proficiency": m["proficiency"]})
+				}
+			}
+		}
+		categories = append(categories, map[string]interface{}{"category": title, "skills": skills})
+	}
+	return map[string]interface{}{"categories": categories}, nil
+}
+
+// -- Tool-calling answer mode --
+
+// runChatTool executes one tool call and returns the JSON result handed back to the model.
+// Results go through the redaction policy and the context guardrail like every other piece of
+// context.
+func runChatTool(ctx context.Context, call openai.ToolCall) (string, error) {
+	tool := findChatTool(call.Function.Name)
+	if tool == nil {
+		return "", fmt.Errorf("unknown tool %q", call.Function.Name)
+	}
+	result, err := tool.Run(ctx, json.RawMessage(call.Function.Arguments))
+	if err != nil {
+		return "", err
+	}
+	raw, err := json.Marshal(result)
+	if err != nil {
+		return "", err
+	}
+	// Round-trip through plain JSON values so the redaction walker sees maps and slices
+	var plain interface{}
+	_ = json.Unmarshal(raw, &plain)
+	plain = currentRedactionPolicy().redactValue(plain, newRedactionReport())
+	raw, _ = json.Marshal(plain)
+	if err := guardToolResult(tool.Def.Name, string(raw)); err != nil {
+		return "", err
+	}
+	return string(raw), nil
+}
+
+// askWithTools answers a query in tool mode: the model gets the retrieved context plus the tool
+// catalogue and may call tools until it produces a final answer or runs out of steps.
+func askWithTools(ctx context.Context, query, conversationMemory string, selected []MemoryItem) (*AskResult, error) {
+	caller, ok := aiProvider.(ToolCaller)
+	if !ok {
+		// Provider cannot call tools (e.g. the fake provider), answer from context only
+		result, err := generateAnswer(ctx, query, conversationMemory, selected)
+		if err != nil {
+			return nil, err
+		}
+		result.Mode = "tools"
+		return result, nil
+	}
+	contextBlock, _ := buildContextBlock(selected, currentRetrievalProfile().ContextCharLimit)
+	prompt, err := answerPrompt(query, conversationMemory, contextBlock, true)
+	if err != nil {
+		return nil, err
+	}
+	messages := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: prompt.System},
+		{Role: openai.ChatMessageRoleUser, Content: prompt.User},
+	}
+	tools := make([]openai.Tool, 0, len(chatTools))
+	for i := range chatTools {
+		tools = append(tools, openai.Tool{Type: openai.ToolTypeFunction, Function: &chatTools[i].Def})
+	}
+	result := &AskResult{Mode: "tools", ToolTrace: []ToolCallRecord{}, Prompt: prompt.Ref}
+	for step := 1; ; step++ {
+		req := openai.ChatCompletionRequest{
+			Messages: messages,
+			Tools:    tools,
+		}
+		// Out of steps: force a final answer from what has been gathered
+		if step > toolMaxSteps {
+			req.ToolChoice = "none"
+		}
+		msg, model, err := completeTaskMessage(ctx, caller, taskAnswer, req)
+		if err != nil {
+			return nil, err
+		}
+		result.Model = model
+		if len(msg.ToolCalls) == 0 || step > toolMaxSteps {
+			result.Answer = strings.TrimSpace(msg.Content)
+			return result, nil
+		}
+		messages = append(messages, msg)
+		for _, call := range msg.ToolCalls {
+			start := time.Now()
+			out, err := runChatTool(ctx, call)
+			record := ToolCallRecord{Step: step, Tool: call.Function.Name, Arguments: call.Function.Arguments, DurationMs: time.Since(start).Milliseconds()}
+			if err != nil {
+				log.Printf("Tool %s failed: %v", call.Function.Name, err)
+				record.Error = err.Error()
+				out = fmt.Sprintf(`{"error": %q}`, err.Error())
+			} else {
+				record.Result = truncateRunes(out, toolTraceResultMax)
+			}
+			result.ToolTrace = append(result.ToolTrace, record)
+			messages = append(messages, openai.ChatCompletionMessage{
+				Role:       openai.ChatMessageRoleTool,
+				ToolCallID: call.ID,
+				Name:       call.Function.Name,
+				Content:    out,
+			})
+		}
+	}
+}
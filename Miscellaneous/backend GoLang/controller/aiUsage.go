@@ -0,0 +1,379 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/portfolio-backend/config"
+	"github.com/gin-gonic/gin"
+	openai "github.com/sashabaranov/go-openai"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ModelPrice is the price of a model in USD per million tokens.
+type ModelPrice struct {
+	Input  float64 `bson:"input" json:"input"`
+	Output float64 `bson:"output" json:"output"`
+}
+
+// PriceTable holds the prices used to estimate the cost of provider calls, keyed by model name
+// or model name prefix (so dated snapshots like "gpt-4o-mini-2024-07-18" match "gpt-4o-mini").
+// It is stored as a single document in the "aiPriceTable" collection of the AI DB.
+type PriceTable struct {
+	Prices    map[string]ModelPrice `bson:"prices" json:"prices"`
+	UpdatedAt time.Time             `bson:"updatedAt" json:"updatedAt"`
+}
+
+// defaultPriceTable returns the list prices of the models the routing uses by default.
+func defaultPriceTable() *PriceTable {
+	return &PriceTable{Prices: map[string]ModelPrice{
+		"gpt-4.1-nano":           {Input: 0.10, Output: 0.40},
+		"gpt-4.1-mini":           {Input: 0.40, Output: 1.60},
+		"gpt-4.1":                {Input: 2.00, Output: 8.00},
+		"gpt-4o-mini":            {Input: 0.15, Output: 0.60},
+		"gpt-4o":                 {Input: 2.50, Output: 10.00},
+		"text-embedding-3-small": {Input: 0.02},
+		"text-embedding-3-large": {Input: 0.13},
+	}}
+}
+
+// Active price table
+var priceTableState = struct {
+	sync.RWMutex
+	table *PriceTable
+}{}
+
+// currentPriceTable returns the active price table.
+func currentPriceTable() *PriceTable {
+	priceTableState.RLock()
+	defer priceTableState.RUnlock()
+	if priceTableState.table == nil {
+		return defaultPriceTable()
+	}
+	return priceTableState.table
+}
+
+// price returns the price of model, matching the longest model name prefix.
+func (t *PriceTable) price(model string) (ModelPrice, bool) {
+	if p, ok := t.Prices[model]; ok {
+		return p, true
+	}
+	best := ""
+	for name := range t.Prices {
+		if strings.HasPrefix(model, name) && len(name) > len(best) {
+			best = name
+		}
+	}
+	p, ok := t.Prices[best]
+	return p, ok && best != ""
+}
+
+// cost estimates the USD cost of a call.
+func (t *PriceTable) cost(model string, promptTokens, completionTokens int) float64 {
+	p, ok := t.price(model)
+	if !ok {
+		return 0
+	}
+	return (float64(promptTokens)*p.Input + float64(completionTokens)*p.Output) / 1e6
+}
+
+// validate checks the price table.
+func (t *PriceTable) validate() []string {
+	var errs []string
+	for model, p := range t.Prices {
+		if strings.TrimSpace(model) == "" {
+			errs = append(errs, "model names must not be empty")
+		}
+		if p.Input < 0 || p.Output < 0 {
+			errs = append(errs, model+": prices must not be negative")
+		}
+	}
+	sort.Strings(errs)
+	return errs
+}
+
+// reloadPriceTable loads the stored price table, keeping the previous one if it is missing or invalid.
+func reloadPriceTable(ctx context.Context) {
+	t := &PriceTable{}
+	err := config.GetDBAI().Collection("aiPriceTable").FindOne(ctx, bson.M{"_id": "priceTable"}).Decode(t)
+	if err != nil || t.Prices == nil {
+		return
+	}
+	if errs := t.validate(); len(errs) > 0 {
+		log.Printf("Invalid price table, keeping previous: %s", strings.Join(errs, "; "))
+		return
+	}
+	priceTableState.Lock()
+	priceTableState.table = t
+	priceTableState.Unlock()
+}
+
+// -- Recording --
+
+// usageEndpointKey and usageTaskKey are the context keys naming the API endpoint and the model
+// routing task a provider call is made for.
+type usageEndpointKey struct{}
+type usageTaskKey struct{}
+
+// TrackAIUsage tags the request context with the route, so provider calls made while serving
+// it are accounted to that endpoint.
+func TrackAIUsage(c *gin.Context) {
+	route := c.FullPath()
+	if route == "" {
+		route = c.Request.URL.Path
+	}
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), usageEndpointKey{}, route))
+	c.Next()
+}
+
+// withUsageTask tags ctx with the routing task of the calls made with it.
+func withUsageTask(ctx context.Context, task string) context.Context {
+	return context.WithValue(ctx, usageTaskKey{}, task)
+}
+
+// usageTags returns the endpoint and task of ctx; calls outside a request, such as index
+// builds, are accounted to "background".
+func usageTags(ctx context.Context) (string, string) {
+	endpoint, _ := ctx.Value(usageEndpointKey{}).(string)
+	if endpoint == "" {
+		endpoint = "background"
+	}
+	task, _ := ctx.Value(usageTaskKey{}).(string)
+	if task == "" {
+		task = "unknown"
+	}
+	return endpoint, task
+}
+
+// UsageTotals sums the provider calls of a period or group.
+type UsageTotals struct {
+	Calls            int64   `bson:"calls" json:"calls"`
+	PromptTokens     int64   `bson:"promptTokens" json:"promptTokens"`
+	CompletionTokens int64   `bson:"completionTokens" json:"completionTokens"`
+	Cost             float64 `bson:"cost" json:"cost"` // estimated, USD
+	LatencyMs        int64   `bson:"latencyMs" json:"latencyMs"`
+}
+
+// add accumulates o.
+func (t *UsageTotals) add(o UsageTotals) {
+	t.Calls += o.Calls
+	t.PromptTokens += o.PromptTokens
+	t.CompletionTokens += o.CompletionTokens
+	t.Cost += o.Cost
+	t.LatencyMs += o.LatencyMs
+}
+
+// Provider usage since the last hourly metrics log
+var hourlyUsage = struct {
+	sync.Mutex
+	totals  UsageTotals
+	byModel map[string]UsageTotals
+}{byModel: map[string]UsageTotals{}}
+
+// recordUsage accounts one successful provider call. The hourly and daily aggregates in the
+// "aiUsage" collection are updated in the background, off the request path.
+func recordUsage(ctx context.Context, model string, usage openai.Usage, latency time.Duration) {
+	endpoint, task := usageTags(ctx)
+	u := UsageTotals{
+		Calls:            1,
+		PromptTokens:     int64(usage.PromptTokens),
+		CompletionTokens: int64(usage.CompletionTokens),
+		Cost:             currentPriceTable().cost(model, usage.PromptTokens, usage.CompletionTokens),
+		LatencyMs:        latency.Milliseconds(),
+	}
+	hourlyUsage.Lock()
+	hourlyUsage.totals.add(u)
+	m := hourlyUsage.byModel[model]
+	m.add(u)
+	hourlyUsage.byModel[model] = m
+	hourlyUsage.Unlock()
+	// CLI runs such as offline evals have no DB to aggregate into
+	if config.AIDB == nil {
+		return
+	}
+	now := time.Now().UTC()
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		for period, start := range map[string]time.Time{"hour": now.Truncate(time.Hour), "day": now.Truncate(24 * time.Hour)} {
+			_, err := config.GetDBAI().Collection("aiUsage").UpdateOne(ctx,
+				bson.M{"_id": fmt.Sprintf("%s|%s|%s|%s|%s", period, start.Format(time.RFC3339), model, endpoint, task)},
+				bson.M{
+					"$setOnInsert": bson.M{"period": period, "start": start, "model": model, "endpoint": endpoint, "task": task},
+					"$inc": bson.M{
+						"calls":            u.Calls,
+						"promptTokens":     u.PromptTokens,
+						"completionTokens": u.CompletionTokens,
+						"cost":             u.Cost,
+						"latencyMs":        u.LatencyMs,
+					},
+				},
+				optionsUpsert(),
+			)
+			if err != nil {
+				log.Println("Error saving AI usage:", err)
+			}
+		}
+	}()
+}
+
+// AIUsageReport is the provider usage since the previous report, for the hourly metrics log.
+type AIUsageReport struct {
+	UsageTotals
+	TopModel     string
+	TopModelCost float64
+}
+
+// TakeAIUsageReport returns the provider usage since the last call and resets it.
+func TakeAIUsageReport() AIUsageReport {
+	hourlyUsage.Lock()
+	defer hourlyUsage.Unlock()
+	r := AIUsageReport{UsageTotals: hourlyUsage.totals}
+	for model, t := range hourlyUsage.byModel {
+		if r.TopModel == "" || t.Cost > r.TopModelCost {
+			r.TopModel, r.TopModelCost = model, t.Cost
+		}
+	}
+	hourlyUsage.totals = UsageTotals{}
+	hourlyUsage.byModel = map[string]UsageTotals{}
+	return r
+}
+
+// -- Admin handlers --
+
+// usageRecord is one stored aggregate.
+type usageRecord struct {
+	Period      string    `bson:"period"`
+	Start       time.Time `bson:"start"`
+	Model       string    `bson:"model"`
+	Endpoint    string    `bson:"endpoint"`
+	Task        string    `bson:"task"`
+	UsageTotals `bson:",inline"`
+}
+
+// usageBucket is the usage of one hour or day.
+type usageBucket struct {
+	Start time.Time `json:"start"`
+	UsageTotals
+}
+
+// addUsage accumulates u into the group's entry for key.
+func addUsage(group map[string]*UsageTotals, key string, u UsageTotals) {
+	if group[key] == nil {
+		group[key] = &UsageTotals{}
+	}
+	group[key].add(u)
+}
+
+// GetAIUsage returns provider usage and estimated cost per hour or day, broken down by model,
+// endpoint and task. Query parameters: period ("hour" or "day", default "day"), and from/to as
+// RFC 3339 times (default the last 48 hours or 30 days).
+func GetAIUsage(c *gin.Context) {
+	period := c.DefaultQuery("period", "day")
+	if period != "hour" && period != "day" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Period must be hour or day"})
+		return
+	}
+	to := time.Now().UTC()
+	from := to.Add(-30 * 24 * time.Hour)
+	if period == "hour" {
+		from = to.Add(-48 * time.Hour)
+	}
+	for name, t := range map[string]*time.Time{"from": &from, "to": &to} {
+		if raw := c.Query(name); raw != "" {
+			parsed, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid " + name + " time, expected RFC 3339"})
+				return
+			}
+			*t = parsed
+		}
+	}
+	// Include the bucket from falls in
+	if period == "day" {
+		from = from.Truncate(24 * time.Hour)
+	} else {
+		from = from.Truncate(time.Hour)
+	}
+	ctx := c.Request.Context()
+	cursor, err := config.GetDBAI().Collection("aiUsage").Find(ctx,
+		bson.M{"period": period, "start": bson.M{"$gte": from, "$lte": to}},
+		options.Find().SetSort(bson.M{"start": 1}),
+	)
+	if err != nil {
+		log.Println("Error loading AI usage:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error loading AI usage"})
+		return
+	}
+	var records []usageRecord
+	if err := cursor.All(ctx, &records); err != nil {
+		log.Println("Error decoding AI usage:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error loading AI usage"})
+		return
+	}
+	var totals UsageTotals
+	byModel, byEndpoint, byTask := map[string]*UsageTotals{}, map[string]*UsageTotals{}, map[string]*UsageTotals{}
+	buckets := []*usageBucket{}
+	for _, r := range records {
+		totals.add(r.UsageTotals)
+		addUsage(byModel, r.Model, r.UsageTotals)
+		addUsage(byEndpoint, r.Endpoint, r.UsageTotals)
+		addUsage(byTask, r.Task, r.UsageTotals)
+		if n := len(buckets); n == 0 || !buckets[n-1].Start.Equal(r.Start) {
+			buckets = append(buckets, &usageBucket{Start: r.Start})
+		}
+		buckets[len(buckets)-1].add(r.UsageTotals)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"period":     period,
+		"from":       from,
+		"to":         to,
+		"totals":     totals,
+		"byModel":    byModel,
+		"byEndpoint": byEndpoint,
+		"byTask":     byTask,
+		"buckets":    buckets,
+	})
+}
+
+// GetPriceTable returns the active price table.
+func GetPriceTable(c *gin.Context) {
+	c.JSON(http.StatusOK, currentPriceTable())
+}
+
+// PutPriceTable validates, stores and activates a price table. Stored usage keeps the cost
+// estimated when it was recorded.
+func PutPriceTable(c *gin.Context) {
+	ctx := c.Request.Context()
+	t := &PriceTable{}
+	if err := c.BindJSON(t); err != nil || t.Prices == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid price table data"})
+		return
+	}
+	if errs := t.validate(); len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid price table", "errors": errs})
+		return
+	}
+	t.UpdatedAt = time.Now()
+	_, err := config.GetDBAI().Collection("aiPriceTable").UpdateOne(ctx,
+		bson.M{"_id": "priceTable"},
+		bson.M{"$set": t},
+		optionsUpsert(),
+	)
+	if err != nil {
+		log.Println("Error saving price table:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving price table"})
+		return
+	}
+	priceTableState.Lock()
+	priceTableState.table = t
+	priceTableState.Unlock()
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Price table saved.", "prices": t})
+}
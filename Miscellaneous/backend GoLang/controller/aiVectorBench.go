@@ -0,0 +1,269 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// VectorBenchOptions controls a vector storage/scoring benchmark run.
+type VectorBenchOptions struct {
+	Replicate int // copies of the snapshot index, to benchmark at a larger size
+	Rounds    int // times every query is scored
+	K         int // cut-off for the top-k agreement with exact scoring
+}
+
+// VectorBenchResult holds the measurements for one vector representation.
+type VectorBenchResult struct {
+	Name          string  `json:"name"`
+	MemoryBytes   int     `json:"memoryBytes"` // vector payload held in memory
+	StoredBytes   int     `json:"storedBytes"` // BSON size of the memoryIndex documents
+	DecodeMs      float64 `json:"decodeMs"`    // time to decode every document into memory
+	ScoreUsPerQry float64 `json:"scoreUsPerQuery"`
+	TopKAgreement float64 `json:"topKAgreement"` // share of the exact top-k also ranked in its top-k
+}
+
+// VectorBenchReport compares float32 storage with serial scoring (the previous layout) against
+// int8 storage with parallel scoring, with and without exact rescoring.
+type VectorBenchReport struct {
+	Embedder   string              `json:"embedder"`
+	Items      int                 `json:"items"`
+	Dimensions int                 `json:"dimensions"`
+	Queries    int                 `json:"queries"`
+	K          int                 `json:"k"`
+	Results    []VectorBenchResult `json:"results"`
+}
+
+// RunVectorBenchmark embeds the snapshot chunks in dir with the configured embedder and measures
+// memory, decode time, scoring latency and ranking agreement of each vector representation.
+func RunVectorBenchmark(ctx context.Context, dir string, queries []string, opts VectorBenchOptions) (*VectorBenchReport, error) {
+	if opts.Replicate <= 0 {
+		opts.Replicate = 1
+	}
+	if opts.Rounds <= 0 {
+		opts.Rounds = 20
+	}
+	if opts.K <= 0 {
+		opts.K = 5
+	}
+	chunks, err := loadSnapshotChunks(dir)
+	if err != nil {
+		return nil, err
+	}
+	embedder := configuredEmbedder()
+	fitEmbedder(embedder, chunks)
+	var vectors [][]float32
+	for _, chunk := range chunks {
+		if strings.TrimSpace(chunk.Text) == "" {
+			continue
+		}
+		emb, err := embedder.Embed(ctx, chunk.Text)
+		if err != nil {
+			return nil, fmt.Errorf("embed %s: %w", chunk.Source, err)
+		}
+		vectors = append(vectors, emb)
+	}
+	if len(vectors) == 0 {
+		return nil, fmt.Errorf("no snapshot chunks found in %s", dir)
+	}
+	var qEmbs [][]float32
+	for _, q := range queries {
+		emb, err := embedder.Embed(ctx, q)
+		if err != nil {
+			return nil, fmt.Errorf("embed query: %w", err)
+		}
+		qEmbs = append(qEmbs, emb)
+	}
+	if len(qEmbs) == 0 {
+		return nil, fmt.Errorf("no benchmark queries")
+	}
+	base := len(vectors)
+	for r := 1; r < opts.Replicate; r++ {
+		vectors = append(vectors, vectors[:base]...)
+	}
+	dims := len(vectors[0])
+	report := &VectorBenchReport{Embedder: embedder.Name(), Items: len(vectors), Dimensions: dims, Queries: len(qEmbs), K: opts.K}
+
+	// Exact scores, scored serially on float32 vectors as before quantization
+	norms := make([]float64, len(vectors))
+	for i, v := range vectors {
+		norms[i] = vectorNorm(v)
+	}
+	serialScores := func(q []float32) []float64 {
+		scores := make([]float64, len(vectors))
+		qNorm := vectorNorm(q)
+		for i, v := range vectors {
+			var dot float64
+			for j, x := range v {
+				dot += float64(x) * float64(q[j])
+			}
+			if norms[i] != 0 && qNorm != 0 {
+				scores[i] = dot / (norms[i] * qNorm)
+			}
+		}
+		return scores
+	}
+	// Agreement is measured on the original chunks, since replicas tie with each other
+	exactTop := make([][]int, len(qEmbs))
+	for i, q := range qEmbs {
+		exactTop[i] = topIndices(serialScores(q)[:base], opts.K)
+	}
+	agreement := func(score func([]float32) []float64) float64 {
+		var hits, total int
+		for i, q := range qEmbs {
+			got := map[int]bool{}
+			for _, j := range topIndices(score(q)[:base], opts.K) {
+				got[j] = true
+			}
+			for _, j := range exactTop[i] {
+				total++
+				if got[j] {
+					hits++
+				}
+			}
+		}
+		return float64(hits) / float64(total)
+	}
+	timeScoring := func(score func([]float32) []float64) float64 {
+		start := time.Now()
+		for r := 0; r < opts.Rounds; r++ {
+			for _, q := range qEmbs {
+				score(q)
+			}
+		}
+		return float64(time.Since(start).Microseconds()) / float64(opts.Rounds*len(qEmbs))
+	}
+
+	// Documents as stored before (array of doubles) and now (BinData vectors, with the float32
+	// vector only when rescoring)
+	legacyDocs := make([][]byte, len(vectors))
+	int8Docs := make([][]byte, len(vectors))
+	exactDocs := make([][]byte, len(vectors))
+	var legacyBytes, int8Bytes, exactBytes int
+	for i, v := range vectors {
+		legacy, err := bson.Marshal(bson.M{"embedding": v})
+		if err != nil {
+			return nil, err
+		}
+		int8Only, err := bson.Marshal(vectorFields(v, false))
+		if err != nil {
+			return nil, err
+		}
+		exact, err := bson.Marshal(vectorFields(v, true))
+		if err != nil {
+			return nil, err
+		}
+		legacyDocs[i], int8Docs[i], exactDocs[i] = legacy, int8Only, exact
+		legacyBytes += len(legacy)
+		int8Bytes += len(int8Only)
+		exactBytes += len(exact)
+	}
+	// Legacy documents are only decoded to float32, as the loader did before quantization
+	decode := func(docs [][]byte, legacy bool) (float64, error) {
+		start := time.Now()
+		for _, raw := range docs {
+			var sv storedVector
+			if err := bson.Unmarshal(raw, &sv); err != nil {
+				return 0, err
+			}
+			var item MemoryItem
+			var err error
+			if legacy {
+				_, err = sv.float32s()
+			} else {
+				err = sv.decode(&item)
+			}
+			if err != nil {
+				return 0, err
+			}
+		}
+		return float64(time.Since(start).Microseconds()) / 1000, nil
+	}
+
+	// Run the int8 measurements with and without rescoring, restoring the configured setting
+	savedRescore := vectorRescoreTop
+	defer func() { vectorRescoreTop = savedRescore }()
+	index := func() []MemoryItem {
+		items := make([]MemoryItem, len(vectors))
+		for i, v := range vectors {
+			items[i].setEmbedding(v)
+		}
+		return items
+	}
+
+	vectorRescoreTop = 0
+	legacyDecode, err := decode(legacyDocs, true)
+	if err != nil {
+		return nil, err
+	}
+	report.Results = append(report.Results, VectorBenchResult{
+		Name:          "float32, serial",
+		MemoryBytes:   len(vectors) * dims * 4,
+		StoredBytes:   legacyBytes,
+		DecodeMs:      legacyDecode,
+		ScoreUsPerQry: timeScoring(serialScores),
+		TopKAgreement: 1,
+	})
+	int8Decode, err := decode(int8Docs, false)
+	if err != nil {
+		return nil, err
+	}
+	quantized := index()
+	score := func(q []float32) []float64 { return scoreIndex(q, quantized) }
+	report.Results = append(report.Results, VectorBenchResult{
+		Name:          "int8, parallel",
+		MemoryBytes:   len(vectors) * (dims + 4),
+		StoredBytes:   int8Bytes,
+		DecodeMs:      int8Decode,
+		ScoreUsPerQry: timeScoring(score),
+		TopKAgreement: agreement(score),
+	})
+	vectorRescoreTop = 4 * opts.K
+	rescoreDecode, err := decode(exactDocs, false)
+	if err != nil {
+		return nil, err
+	}
+	rescored := index()
+	score = func(q []float32) []float64 { return scoreIndex(q, rescored) }
+	report.Results = append(report.Results, VectorBenchResult{
+		Name:          fmt.Sprintf("int8, parallel, rescore top %d", vectorRescoreTop),
+		MemoryBytes:   len(vectors) * (dims*5 + 4),
+		StoredBytes:   exactBytes,
+		DecodeMs:      rescoreDecode,
+		ScoreUsPerQry: timeScoring(score),
+		TopKAgreement: agreement(score),
+	})
+	return report, nil
+}
+
+// topIndices returns the positions of the k highest scores.
+func topIndices(scores []float64, k int) []int {
+	order := make([]int, 0, len(scores))
+	for i, s := range scores {
+		if !math.IsNaN(s) {
+			order = append(order, i)
+		}
+	}
+	sort.SliceStable(order, func(a, b int) bool { return scores[order[a]] > scores[order[b]] })
+	if len(order) > k {
+		order = order[:k]
+	}
+	return order
+}
+
+// FormatVectorBenchReport renders a benchmark report as a table.
+func FormatVectorBenchReport(r *VectorBenchReport) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Embedder: %s | Items: %d | Dimensions: %d | Queries: %d\n\n", r.Embedder, r.Items, r.Dimensions, r.Queries)
+	fmt.Fprintf(&b, "%-32s %12s %12s %10s %12s %8s\n", "Representation", "Memory KB", "Stored KB", "Decode ms", "Score µs/q", fmt.Sprintf("Top-%d", r.K))
+	for _, res := range r.Results {
+		fmt.Fprintf(&b, "%-32s %12.1f %12.1f %10.2f %12.1f %8.3f\n", res.Name,
+			float64(res.MemoryBytes)/1024, float64(res.StoredBytes)/1024, res.DecodeMs, res.ScoreUsPerQry, res.TopKAgreement)
+	}
+	return b.String()
+}
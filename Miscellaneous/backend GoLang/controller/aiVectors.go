@@ -0,0 +1,262 @@
+package controllers
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"runtime"
+	"sort"
+	"sync"
+
+	"example.com/portfolio-backend/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// vectorRescoreTop is how many of the best int8 candidates are rescored with the exact float32
+// vectors; 0 disables rescoring and float32 vectors are then not kept in memory.
+var vectorRescoreTop = config.EnvInt("AI_VECTOR_RESCORE_TOP", 0)
+
+// parallelScoreMin is the index size from which scoring is split across goroutines.
+const parallelScoreMin = 256
+
+// QuantizedVector is an embedding stored as int8 with one scale per vector:
+// value[i] ≈ Data[i] * Scale.
+type QuantizedVector struct {
+	Data  []int8
+	Scale float32
+	Norm  float64 // norm of the dequantized vector
+}
+
+// quantizeVector symmetrically quantizes vec to int8 using its largest magnitude.
+func quantizeVector(vec []float32) QuantizedVector {
+	var maxAbs float32
+	for _, x := range vec {
+		if x < 0 {
+			x = -x
+		}
+		if x > maxAbs {
+			maxAbs = x
+		}
+	}
+	q := QuantizedVector{Data: make([]int8, len(vec))}
+	if maxAbs == 0 {
+		return q
+	}
+	q.Scale = maxAbs / 127
+	var sum float64
+	for i, x := range vec {
+		v := int8(math.Round(float64(x / q.Scale)))
+		q.Data[i] = v
+		sum += float64(v) * float64(v)
+	}
+	q.Norm = math.Sqrt(sum) * float64(q.Scale)
+	return q
+}
+
+// dot returns the dot product of two dequantized vectors of the same size, accumulated in
+// integers and unrolled by four.
+func (q QuantizedVector) dot(other QuantizedVector) float64 {
+	a, b := q.Data, other.Data[:len(q.Data)]
+	var s0, s1, s2, s3 int32
+	i := 0
+	for ; i+4 <= len(a); i += 4 {
+		s0 += int32(a[i]) * int32(b[i])
+		s1 += int32(a[i+1]) * int32(b[i+1])
+		s2 += int32(a[i+2]) * int32(b[i+2])
+		s3 += int32(a[i+3]) * int32(b[i+3])
+	}
+	for ; i < len(a); i++ {
+		s0 += int32(a[i]) * int32(b[i])
+	}
+	return float64(s0+s1+s2+s3) * float64(q.Scale) * float64(other.Scale)
+}
+
+// setEmbedding stores emb on the item as a quantized vector, keeping the float32 vector only
+// when exact rescoring is enabled.
+func (item *MemoryItem) setEmbedding(emb []float32) {
+	item.Vector = quantizeVector(emb)
+	item.Norm = vectorNorm(emb)
+	item.Embedding = nil
+	if vectorRescoreTop > 0 {
+		item.Embedding = emb
+	}
+}
+
+// dimensions is the size of the item's vector.
+func (item *MemoryItem) dimensions() int {
+	return len(item.Vector.Data)
+}
+
+// -- Mongo encoding --
+
+// BSON binary subtype and dtypes of the vector format Atlas Vector Search understands
+const (
+	bsonVectorSubtype = 0x09
+	bsonVectorInt8    = 0x03
+	bsonVectorFloat32 = 0x27
+)
+
+// storeExactVectors reports whether memoryIndex documents keep the float32 vector next to the
+// int8 one. Only rescoring and Atlas Vector Search read it, and it is four times the size.
+func storeExactVectors() bool {
+	return vectorRescoreTop > 0 || atlasVectorSearch
+}
+
+// vectorFields returns the memoryIndex document fields for emb: the int8 vector with its
+// scale and, when exact is set, the float32 vector for rescoring and Atlas search, both as
+// BinData.
+func vectorFields(emb []float32, exact bool) bson.M {
+	q := quantizeVector(emb)
+	i8 := make([]byte, 2+len(q.Data))
+	i8[0] = bsonVectorInt8
+	for i, v := range q.Data {
+		i8[2+i] = byte(v)
+	}
+	fields := bson.M{
+		"embeddingInt8":  primitive.Binary{Subtype: bsonVectorSubtype, Data: i8},
+		"embeddingScale": q.Scale,
+	}
+	if !exact {
+		return fields
+	}
+	f32 := make([]byte, 2+4*len(emb))
+	f32[0] = bsonVectorFloat32
+	for i, x := range emb {
+		binary.LittleEndian.PutUint32(f32[2+4*i:], math.Float32bits(x))
+	}
+	fields["embedding"] = primitive.Binary{Subtype: bsonVectorSubtype, Data: f32}
+	return fields
+}
+
+// storedVector is the vector part of a memoryIndex document. Documents written before
+// quantization only have "embedding" as an array of doubles; documents written without
+// storeExactVectors only have the int8 vector.
+type storedVector struct {
+	Int8      primitive.Binary `bson:"embeddingInt8"`
+	Scale     float32          `bson:"embeddingScale"`
+	Embedding bson.RawValue    `bson:"embedding"`
+}
+
+// decode fills the item's vectors. The float32 vector is only decoded when it is needed for
+// rescoring or has to be quantized because the document predates quantization.
+func (sv storedVector) decode(item *MemoryItem) error {
+	if len(sv.Int8.Data) >= 2 && sv.Int8.Data[0] == bsonVectorInt8 {
+		data := make([]int8, len(sv.Int8.Data)-2)
+		var sum float64
+		for i, b := range sv.Int8.Data[2:] {
+			data[i] = int8(b)
+			sum += float64(data[i]) * float64(data[i])
+		}
+		item.Vector = QuantizedVector{Data: data, Scale: sv.Scale, Norm: math.Sqrt(sum) * float64(sv.Scale)}
+		item.Norm = item.Vector.Norm
+		// Without a stored float32 vector the item is rescored on its int8 vector
+		if vectorRescoreTop == 0 || len(sv.Embedding.Value) == 0 {
+			return nil
+		}
+	}
+	emb, err := sv.float32s()
+	if err != nil {
+		return err
+	}
+	if item.Vector.Data == nil {
+		item.setEmbedding(emb)
+		return nil
+	}
+	item.Embedding, item.Norm = emb, vectorNorm(emb)
+	return nil
+}
+
+// float32s decodes the "embedding" field, either a float32 BinData vector or a legacy array.
+func (sv storedVector) float32s() ([]float32, error) {
+	switch sv.Embedding.Type {
+	case bsontype.Binary:
+		subtype, data := sv.Embedding.Binary()
+		if subtype != bsonVectorSubtype || len(data) < 2 || data[0] != bsonVectorFloat32 || (len(data)-2)%4 != 0 {
+			return nil, fmt.Errorf("unsupported embedding encoding")
+		}
+		vec := make([]float32, (len(data)-2)/4)
+		for i := range vec {
+			vec[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[2+4*i:]))
+		}
+		return vec, nil
+	case bsontype.Array:
+		values, err := sv.Embedding.Array().Values()
+		if err != nil {
+			return nil, err
+		}
+		vec := make([]float32, len(values))
+		for i, v := range values {
+			if f, ok := v.DoubleOK(); ok {
+				vec[i] = float32(f)
+			}
+		}
+		return vec, nil
+	}
+	return nil, fmt.Errorf("missing embedding")
+}
+
+// -- Scoring --
+
+// scoreIndex returns the cosine similarity of the query with every item of index, computed on
+// int8 vectors (the query is quantized too) across goroutines. Items with a different
+// dimension score NaN. When rescoring is enabled the best candidates are recomputed with their
+// float32 vectors.
+func scoreIndex(qEmb []float32, index []MemoryItem) []float64 {
+	scores := make([]float64, len(index))
+	query := quantizeVector(qEmb)
+	score := func(from, to int) {
+		for i := from; i < to; i++ {
+			item := &index[i]
+			switch {
+			case item.dimensions() != len(qEmb):
+				scores[i] = math.NaN()
+			case item.Vector.Norm == 0 || query.Norm == 0:
+				scores[i] = 0
+			default:
+				scores[i] = item.Vector.dot(query) / (item.Vector.Norm * query.Norm)
+			}
+		}
+	}
+	workers := runtime.GOMAXPROCS(0)
+	if len(index) < parallelScoreMin || workers == 1 {
+		score(0, len(index))
+	} else {
+		var wg sync.WaitGroup
+		size := (len(index) + workers - 1) / workers
+		for from := 0; from < len(index); from += size {
+			to := from + size
+			if to > len(index) {
+				to = len(index)
+			}
+			wg.Add(1)
+			go func(from, to int) {
+				defer wg.Done()
+				score(from, to)
+			}(from, to)
+		}
+		wg.Wait()
+	}
+	if vectorRescoreTop > 0 {
+		rescoreTop(qEmb, vectorNorm(qEmb), index, scores, vectorRescoreTop)
+	}
+	return scores
+}
+
+// rescoreTop replaces the scores of the top n candidates by exact float32 cosine similarities.
+func rescoreTop(qEmb []float32, qNorm float64, index []MemoryItem, scores []float64, n int) {
+	order := make([]int, 0, len(scores))
+	for i, s := range scores {
+		if !math.IsNaN(s) && index[i].Embedding != nil {
+			order = append(order, i)
+		}
+	}
+	sort.Slice(order, func(a, b int) bool { return scores[order[a]] > scores[order[b]] })
+	if len(order) > n {
+		order = order[:n]
+	}
+	for _, i := range order {
+		scores[i] = cosineSimilarity(qEmb, qNorm, index[i].Embedding)
+	}
+}
@@ -40,7 +40,7 @@ var dynamicImagesCache = struct {
 // Initialize image caches and schedule updates every 12 hours
 func init() {
 	updateMustLoadImagesCache()
-	updateDynamicImagesCache()
+	// Dynamic images need the DB, which is not connected during init; GetDynamicImages loads them lazily
 	// Schedule caches to update periodically (12 hours)
 	ticker := time.NewTicker(12 * time.Hour)
 	go func() {
@@ -932,7 +932,7 @@ func SetAdminCredentials(c *gin.Context) {
 	db := config.GetDB()
 	// Fetch current admin record
 	var admin bson.M
-	err := db.Collection("KartavyaPortfolio").FindOne(ctx, bson.M{}).Decode(&admin)
+	err := db.Collection(config.AdminCollection).FindOne(ctx, bson.M{}).Decode(&admin)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"message": "Admin not found."})
 		return
@@ -947,9 +947,9 @@ func SetAdminCredentials(c *gin.Context) {
 	// Hash new credentials and replace record
 	newUserHash, _ := hashPassword(reqBody.UserName)
 	newPassHash, _ := hashPassword(reqBody.Password)
-	_, err = db.Collection("KartavyaPortfolio").DeleteMany(ctx, bson.M{})
+	_, err = db.Collection(config.AdminCollection).DeleteMany(ctx, bson.M{})
 	if err == nil {
-		_, err = db.Collection("KartavyaPortfolio").InsertOne(ctx, bson.M{"userName": newUserHash, "password": newPassHash})
+		_, err = db.Collection(config.AdminCollection).InsertOne(ctx, bson.M{"userName": newUserHash, "password": newPassHash})
 	}
 	if err != nil {
 		log.Println("Error setting admin credentials:", err)
@@ -0,0 +1,267 @@
+package controllers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math"
+	"math/bits"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/portfolio-backend/config"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Proof-of-work settings. Difficulty is the number of leading zero bits the solution hash
+// needs; each extra bit doubles the expected work. It rises by one bit each time a protected
+// route's requests per minute double beyond powPressureThreshold.
+var (
+	powEnabled           = config.EnvString("POW_ENABLED", "false") == "true"
+	powBaseDifficulty    = config.EnvInt("POW_BASE_DIFFICULTY", 14)
+	powMaxDifficulty     = config.EnvInt("POW_MAX_DIFFICULTY", 22)
+	powPressureThreshold = config.EnvFloat("POW_PRESSURE_THRESHOLD", 30)
+	powTTL               = config.EnvDuration("POW_TTL", 5*time.Minute)
+)
+
+// powSecret signs challenges. Without POW_SECRET or JWT_SECRET a random per-process key is
+// used, which only works for a single instance.
+var powSecret = func() []byte {
+	for _, name := range []string{"POW_SECRET", "JWT_SECRET"} {
+		if s := os.Getenv(name); s != "" {
+			return []byte(s)
+		}
+	}
+	key := make([]byte, 32)
+	rand.Read(key)
+	return key
+}()
+
+// Headers carrying a solved challenge
+const (
+	powChallengeHeader = "X-PoW-Challenge"
+	powNonceHeader     = "X-PoW-Nonce"
+)
+
+// powChallenge is a signed, self-contained challenge: the server keeps no state until it is
+// redeemed. The client finds a nonce such that SHA-256("<challenge>:<nonce>") starts with
+// Difficulty zero bits.
+type powChallenge struct {
+	Algorithm  string    `json:"algorithm"`
+	Challenge  string    `json:"challenge"`
+	Difficulty int       `json:"difficulty"`
+	Scope      string    `json:"scope"`
+	Expires    time.Time `json:"expires"`
+	Required   bool      `json:"required"` // false while POW_ENABLED is off; solving is then optional
+}
+
+// powSign returns the HMAC of payload, base64url encoded.
+func powSign(payload string) string {
+	mac := hmac.New(sha256.New, powSecret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// newPowChallenge issues a challenge for scope at the scope's current difficulty.
+func newPowChallenge(scope string) powChallenge {
+	salt := make([]byte, 12)
+	rand.Read(salt)
+	expires := time.Now().Add(powTTL).Truncate(time.Second)
+	difficulty := powDifficulty(scope)
+	payload := fmt.Sprintf("%s|%d|%d|%s", hex.EncodeToString(salt), expires.Unix(), difficulty, scope)
+	return powChallenge{
+		Algorithm:  "SHA-256",
+		Challenge:  base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + powSign(payload),
+		Difficulty: difficulty,
+		Scope:      scope,
+		Expires:    expires,
+		Required:   powEnabled,
+	}
+}
+
+// verifyPow checks a solved challenge for scope and returns its salt, used to detect replays.
+func verifyPow(scope, challenge, nonce string) (string, error) {
+	encoded, sig, ok := strings.Cut(challenge, ".")
+	if !ok || nonce == "" || len(nonce) > 64 {
+		return "", fmt.Errorf("malformed challenge")
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || !hmac.Equal([]byte(sig), []byte(powSign(string(raw)))) {
+		return "", fmt.Errorf("invalid challenge signature")
+	}
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 4 || parts[3] != scope {
+		return "", fmt.Errorf("challenge is for another scope")
+	}
+	expires, _ := strconv.ParseInt(parts[1], 10, 64)
+	if time.Now().Unix() > expires {
+		return "", fmt.Errorf("challenge expired")
+	}
+	difficulty, _ := strconv.Atoi(parts[2])
+	if leadingZeroBits(sha256.Sum256([]byte(challenge+":"+nonce))) < difficulty {
+		return "", fmt.Errorf("solution does not meet difficulty %d", difficulty)
+	}
+	return parts[0], nil
+}
+
+// leadingZeroBits counts the zero bits the hash starts with.
+func leadingZeroBits(sum [sha256.Size]byte) int {
+	n := 0
+	for _, b := range sum {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
+
+// ensurePowReplayIndex makes redeemed challenges expire with the challenge itself.
+var ensurePowReplayIndex sync.Once
+
+// redeemPow records the challenge salt as used and reports whether it was already redeemed.
+// Redeemed salts live in the "powReplays" collection, so replays are caught across instances.
+func redeemPow(ctx context.Context, salt string) (bool, error) {
+	coll := config.GetDBAI().Collection("powReplays")
+	ensurePowReplayIndex.Do(func() {
+		_, err := coll.CreateIndex(ctx, mongo.IndexModel{
+			Keys:    bson.M{"expiresAt": 1},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		})
+		if err != nil {
+			log.Println("Error creating proof-of-work replay index:", err)
+		}
+	})
+	_, err := coll.InsertOne(ctx, bson.M{"_id": salt, "expiresAt": time.Now().Add(powTTL)})
+	if mongo.IsDuplicateKeyError(err) {
+		return true, nil
+	}
+	return false, err
+}
+
+// -- Request pressure --
+
+// requestPressure counts requests per minute with a sliding window over two fixed minutes.
+type requestPressure struct {
+	sync.Mutex
+	minute            int64
+	current, previous float64
+}
+
+// observe counts one request.
+func (p *requestPressure) observe(now time.Time) {
+	p.Lock()
+	defer p.Unlock()
+	p.roll(now)
+	p.current++
+}
+
+// perMinute estimates the requests of the last minute.
+func (p *requestPressure) perMinute(now time.Time) float64 {
+	p.Lock()
+	defer p.Unlock()
+	p.roll(now)
+	elapsed := float64(now.Unix()%60) / 60
+	return p.previous*(1-elapsed) + p.current
+}
+
+func (p *requestPressure) roll(now time.Time) {
+	minute := now.Unix() / 60
+	switch {
+	case minute == p.minute:
+	case minute == p.minute+1:
+		p.previous, p.current = p.current, 0
+	default:
+		p.previous, p.current = 0, 0
+	}
+	p.minute = minute
+}
+
+// Pressure of the protected routes, by scope (registered by RequireProofOfWork) and by route
+// (fed by the metrics middleware)
+var powScopes, powRoutes sync.Map
+
+// ObserveRequestPressure counts a served request towards the proof-of-work difficulty of its
+// route; routes without a challenge are ignored.
+func ObserveRequestPressure(route string) {
+	if p, ok := powRoutes.Load(route); ok {
+		p.(*requestPressure).observe(time.Now())
+	}
+}
+
+// powDifficulty is the difficulty currently required for scope.
+func powDifficulty(scope string) int {
+	difficulty := powBaseDifficulty
+	if p, ok := powScopes.Load(scope); ok && powPressureThreshold > 0 {
+		if rate := p.(*requestPressure).perMinute(time.Now()); rate > powPressureThreshold {
+			difficulty += int(math.Log2(rate/powPressureThreshold)) + 1
+		}
+	}
+	if difficulty > powMaxDifficulty {
+		difficulty = powMaxDifficulty
+	}
+	return difficulty
+}
+
+// -- Handlers --
+
+// GetPowChallenge issues a challenge for the scope in the query (e.g. ?scope=ask-chat).
+func GetPowChallenge(c *gin.Context) {
+	scope := c.Query("scope")
+	if _, ok := powScopes.Load(scope); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Unknown proof-of-work scope"})
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, newPowChallenge(scope))
+}
+
+// RequireProofOfWork demands a solved challenge of scope in the X-PoW-Challenge and
+// X-PoW-Nonce headers when POW_ENABLED is set. Requests without a valid, unused solution get
+// 428 with a fresh challenge to solve. Admin requests are exempt.
+func RequireProofOfWork(scope string) gin.HandlerFunc {
+	pressure, _ := powScopes.LoadOrStore(scope, &requestPressure{})
+	return func(c *gin.Context) {
+		// The route learns its scope so the metrics middleware can feed its pressure
+		powRoutes.LoadOrStore(c.FullPath(), pressure)
+		if !powEnabled || isAdminRequest(c) {
+			c.Next()
+			return
+		}
+		salt, err := verifyPow(scope, c.GetHeader(powChallengeHeader), c.GetHeader(powNonceHeader))
+		if err == nil {
+			var replayed bool
+			replayed, err = redeemPow(c.Request.Context(), salt)
+			if err != nil {
+				// Fail open: the solution is valid, only replay tracking is unavailable
+				log.Println("Error recording proof-of-work redemption:", err)
+			} else if replayed {
+				err = fmt.Errorf("challenge already used")
+			}
+		}
+		if err == nil {
+			c.Next()
+			return
+		}
+		message := "Please solve the proof-of-work challenge."
+		if c.GetHeader(powChallengeHeader) != "" {
+			message = "Proof-of-work rejected: " + err.Error() + "."
+		}
+		c.AbortWithStatusJSON(http.StatusPreconditionRequired, gin.H{
+			"message":   message,
+			"challenge": newPowChallenge(scope),
+		})
+	}
+}
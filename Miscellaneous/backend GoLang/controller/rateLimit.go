@@ -0,0 +1,269 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/portfolio-backend/config"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// What rate limits are keyed on. Session and API key limits fall back to the client IP when
+// the request has no session or key.
+const (
+	RateKeyIP      = "ip"
+	RateKeySession = "session" // the X-Chat-Session header
+	RateKeyAPIKey  = "apikey"  // the X-API-Key header
+)
+
+// RateLimit configures a token bucket: up to Burst requests at once, refilled at Rate requests
+// per second. A zero rate disables the limit.
+type RateLimit struct {
+	Name  string  // route group, used for env overrides and in the metrics
+	Rate  float64 // tokens per second
+	Burst int
+	Key   string // RateKeyIP, RateKeySession or RateKeyAPIKey
+}
+
+// bucketStore holds token buckets. take spends one token from key's bucket and returns whether
+// the request is allowed and the tokens left.
+type bucketStore interface {
+	take(ctx context.Context, key string, limit RateLimit, now time.Time) (bool, float64, error)
+}
+
+// rateLimitStore is shared by all limiters: "memory" (default) per instance, or "mongo" to share
+// the buckets between instances.
+var rateLimitStore = newRateLimitStore(config.EnvString("RATE_LIMIT_STORE", "memory"))
+
+func newRateLimitStore(kind string) bucketStore {
+	if kind == "mongo" {
+		return &mongoRateLimitStore{}
+	}
+	return &memoryRateLimitStore{buckets: map[string]*tokenBucket{}}
+}
+
+// -- In-memory store --
+
+type tokenBucket struct {
+	limit   RateLimit
+	tokens  float64
+	updated time.Time
+}
+
+// refill adds the tokens earned since the last update, up to the burst.
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens = math.Min(float64(b.limit.Burst), b.tokens+now.Sub(b.updated).Seconds()*b.limit.Rate)
+	b.updated = now
+}
+
+// memoryRateLimitStore keeps buckets in process memory; idle buckets are swept once full.
+type memoryRateLimitStore struct {
+	sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+func (s *memoryRateLimitStore) take(_ context.Context, key string, limit RateLimit, now time.Time) (bool, float64, error) {
+	s.Lock()
+	defer s.Unlock()
+	if now.Sub(s.lastSweep) > time.Minute {
+		for k, b := range s.buckets {
+			if b.refill(now); b.tokens >= float64(b.limit.Burst) {
+				delete(s.buckets, k)
+			}
+		}
+		s.lastSweep = now
+	}
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &tokenBucket{limit: limit, tokens: float64(limit.Burst), updated: now}
+		s.buckets[key] = b
+	}
+	b.refill(now)
+	if b.tokens < 1 {
+		return false, b.tokens, nil
+	}
+	b.tokens--
+	return true, b.tokens, nil
+}
+
+// -- Mongo store --
+
+// mongoRateLimitStore keeps buckets in the "rateLimits" collection of the AI DB. Each take is a
+// single atomic pipeline update, so instances never double-spend a token.
+type mongoRateLimitStore struct {
+	indexOnce sync.Once
+}
+
+func (s *mongoRateLimitStore) take(ctx context.Context, key string, limit RateLimit, now time.Time) (bool, float64, error) {
+	coll := config.GetDBAI().Collection("rateLimits")
+	s.indexOnce.Do(func() {
+		_, err := coll.CreateIndex(ctx, mongo.IndexModel{
+			Keys:    bson.M{"expiresAt": 1},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		})
+		if err != nil {
+			log.Println("Error creating rate limit expiry index:", err)
+		}
+	})
+	burst := float64(limit.Burst)
+	elapsed := bson.M{"$divide": bson.A{bson.M{"$subtract": bson.A{now, bson.M{"$ifNull": bson.A{"$updatedAt", now}}}}, 1000}}
+	refilled := bson.M{"$min": bson.A{burst, bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$tokens", burst}}, bson.M{"$multiply": bson.A{elapsed, limit.Rate}}}}}}
+	// A bucket left alone until it is full again carries no state
+	expiresAt := now.Add(time.Duration(burst / limit.Rate * float64(time.Second)))
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"tokens": refilled, "updatedAt": now, "expiresAt": expiresAt}}},
+		{{Key: "$set", Value: bson.M{"allowed": bson.M{"$gte": bson.A{"$tokens", 1}}}}},
+		{{Key: "$set", Value: bson.M{"tokens": bson.M{"$cond": bson.A{"$allowed", bson.M{"$subtract": bson.A{"$tokens", 1}}, "$tokens"}}}}},
+	}
+	var bucket struct {
+		Tokens  float64 `bson:"tokens"`
+		Allowed bool    `bson:"allowed"`
+	}
+	err := coll.FindOneAndUpdate(ctx, bson.M{"_id": key}, pipeline,
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&bucket)
+	return bucket.Allowed, bucket.Tokens, err
+}
+
+// -- Middleware --
+
+// rateLimiter is one configured limit and its counters for the hourly metrics.
+type rateLimiter struct {
+	RateLimit
+	sync.Mutex
+	allowed int64
+	limited int64
+	clients map[string]int64 // limited requests by client key, up to maxLimitedClients
+}
+
+// maxLimitedClients bounds the per-client counters kept between metrics reports.
+const maxLimitedClients = 1000
+
+// Registered limiters, in registration order
+var rateLimiters struct {
+	sync.Mutex
+	list []*rateLimiter
+}
+
+// NewRateLimiter returns middleware enforcing limit on the routes it is attached to. The
+// defaults can be overridden with RATE_LIMIT_<NAME>_RATE, _BURST and _KEY. Responses carry
+// RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset and RateLimit-Policy headers; rejected
+// requests get 429 with Retry-After.
+func NewRateLimiter(limit RateLimit) gin.HandlerFunc {
+	env := "RATE_LIMIT_" + strings.ToUpper(limit.Name)
+	limit.Rate = config.EnvFloat(env+"_RATE", limit.Rate)
+	limit.Burst = config.EnvInt(env+"_BURST", limit.Burst)
+	limit.Key = config.EnvString(env+"_KEY", limit.Key)
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+	if limit.Rate <= 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+	l := &rateLimiter{RateLimit: limit, clients: map[string]int64{}}
+	rateLimiters.Lock()
+	rateLimiters.list = append(rateLimiters.list, l)
+	rateLimiters.Unlock()
+	// The window is the time an empty bucket takes to refill
+	window := int(math.Ceil(float64(limit.Burst) / limit.Rate))
+	return func(c *gin.Context) {
+		clientKey := l.clientKey(c)
+		allowed, tokens, err := rateLimitStore.take(c.Request.Context(), l.Name+"|"+clientKey, l.RateLimit, time.Now())
+		if err != nil {
+			// Fail open: a store hiccup shouldn't take the API down
+			log.Printf("Error checking %s rate limit: %v", l.Name, err)
+			c.Next()
+			return
+		}
+		remaining := int(math.Max(0, math.Floor(tokens)))
+		c.Header("RateLimit-Limit", strconv.Itoa(l.Burst))
+		c.Header("RateLimit-Remaining", strconv.Itoa(remaining))
+		c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d", l.Burst, window))
+		l.Lock()
+		if allowed {
+			l.allowed++
+		} else {
+			l.limited++
+			if len(l.clients) < maxLimitedClients || l.clients[clientKey] > 0 {
+				l.clients[clientKey]++
+			}
+		}
+		l.Unlock()
+		if allowed {
+			// Seconds until the bucket is full again
+			c.Header("RateLimit-Reset", strconv.Itoa(int(math.Ceil((float64(l.Burst)-tokens)/l.Rate))))
+			c.Next()
+			return
+		}
+		// Seconds until the next token
+		wait := strconv.Itoa(int(math.Ceil((1 - tokens) / l.Rate)))
+		c.Header("RateLimit-Reset", wait)
+		c.Header("Retry-After", wait)
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"message": "Too many requests. Please slow down and try again shortly."})
+	}
+}
+
+// clientKey identifies the client the limit applies to.
+func (l *rateLimiter) clientKey(c *gin.Context) string {
+	switch l.Key {
+	case RateKeySession:
+		if session := c.GetHeader(sessionHeader); session != "" && len(session) <= 100 {
+			return "session:" + session
+		}
+	case RateKeyAPIKey:
+		if key := c.GetHeader("X-API-Key"); key != "" {
+			// Keep the key itself out of the store and the logs
+			sum := sha256.Sum256([]byte(key))
+			return "apikey:" + hex.EncodeToString(sum[:8])
+		}
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// RateLimitReport is one limiter's activity since the previous report, for the hourly metrics log.
+type RateLimitReport struct {
+	Name        string
+	Rate        float64
+	Burst       int
+	Key         string
+	Allowed     int64
+	Limited     int64
+	TopClient   string // the client limited most often
+	TopLimited  int64
+	ClientCount int // distinct clients limited (capped)
+}
+
+// TakeRateLimitReport returns every limiter's activity since the last call and resets it.
+func TakeRateLimitReport() []RateLimitReport {
+	rateLimiters.Lock()
+	defer rateLimiters.Unlock()
+	reports := make([]RateLimitReport, 0, len(rateLimiters.list))
+	for _, l := range rateLimiters.list {
+		l.Lock()
+		r := RateLimitReport{Name: l.Name, Rate: l.Rate, Burst: l.Burst, Key: l.Key, Allowed: l.allowed, Limited: l.limited, ClientCount: len(l.clients)}
+		for client, n := range l.clients {
+			if n > r.TopLimited || (n == r.TopLimited && client < r.TopClient) {
+				r.TopClient, r.TopLimited = client, n
+			}
+		}
+		l.allowed, l.limited, l.clients = 0, 0, map[string]int64{}
+		l.Unlock()
+		reports = append(reports, r)
+	}
+	sort.SliceStable(reports, func(i, j int) bool { return reports[i].Name < reports[j].Name })
+	return reports
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"example.com/portfolio-backend/config"
+	"example.com/portfolio-backend/controllers"
+)
+
+// runEvalCommand implements the `eval` subcommand: it scores the retrieval pipeline against a
+// golden question set, either with an in-memory index built from snapshot files or with the
+// memory index stored in the AI DB.
+func runEvalCommand(args []string) error {
+	fs := flag.NewFlagSet("eval", flag.ContinueOnError)
+	goldenPath := fs.String("golden", "data/eval/golden-set.json", "golden question set (.json, .yaml or .yml)")
+	snapshotDir := fs.String("snapshots", "", "directory with db-context.json, github-context.json and resume-context.json; empty reads the AI DB memory index, which -provider/-embedder must have built")
+	providerName := fs.String("provider", "fake", "embedding/chat provider: fake or openai")
+	embedderName := fs.String("embedder", "provider", "embedder: provider (embed with -provider) or local (offline TF-IDF)")
+	profilePath := fs.String("profile", "", "retrieval profile JSON file to evaluate instead of the built-in defaults")
+	k := fs.Int("k", 5, "cut-off for recall@k and MRR")
+	grade := fs.Bool("grade", false, "generate answers and grade them against expectedAnswer")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if err := selectProviders(*providerName, *embedderName); err != nil {
+		return err
+	}
+
+	set, err := controllers.LoadGoldenSet(*goldenPath)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	var index []controllers.MemoryItem
+	if *snapshotDir != "" {
+		index, err = controllers.BuildIndexFromSnapshots(ctx, *snapshotDir)
+	} else {
+		if err := config.ConnectDB(os.Getenv("MONGO_URI"), os.Getenv("MONGO_DB_NAME"), os.Getenv("MONGO_DB_NAME_AI")); err != nil {
+			return err
+		}
+		index, err = controllers.CurrentMemoryIndex(ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	opts := controllers.EvalOptions{K: *k, Grade: *grade}
+	if *profilePath != "" {
+		if opts.Profile, err = controllers.LoadRetrievalProfileFile(*profilePath); err != nil {
+			return err
+		}
+	}
+	report, err := controllers.RunRetrievalEval(ctx, set, index, opts)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	fmt.Print(controllers.FormatEvalReport(report))
+	return nil
+}
+
+// selectProviders activates the chat/embedding provider and the embedder named on the command line.
+func selectProviders(providerName, embedderName string) error {
+	switch providerName {
+	case "fake":
+		controllers.SetProvider(controllers.FakeProvider{})
+	case "openai":
+		if err := config.InitOpenAI(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown provider %q (want fake or openai)", providerName)
+	}
+	switch embedderName {
+	case "provider":
+		controllers.SetEmbedder(nil)
+	case "local":
+		controllers.SetEmbedder(controllers.NewLocalEmbedder(0))
+	default:
+		return fmt.Errorf("unknown embedder %q (want provider or local)", embedderName)
+	}
+	return nil
+}
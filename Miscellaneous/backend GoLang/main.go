@@ -22,6 +22,20 @@ import (
 )
 
 func main() {
+	// Subcommand: `eval` runs the retrieval evaluation harness and exits
+	if len(os.Args) > 1 && os.Args[1] == "eval" {
+		if err := runEvalCommand(os.Args[2:]); err != nil {
+			log.Fatal("Eval failed:", err)
+		}
+		return
+	}
+	// Subcommand: `bench` benchmarks vector storage and scoring and exits
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		if err := runBenchCommand(os.Args[2:]); err != nil {
+			log.Fatal("Bench failed:", err)
+		}
+		return
+	}
 	// Load environment variables from .env file if present
 	if err := config.InitOpenAI(); err != nil {
 		log.Fatal(err)
@@ -32,12 +46,21 @@ func main() {
 	if err := config.ConnectDB(mongoURI, dbName, aiDbName); err != nil {
 		log.Fatal(err)
 	}
-	// Initialize AI context (load/update snapshots and memory index)
-	if err := controllers.InitContext(); err != nil {
-		log.Fatal("AI context initialization failed:", err)
-	}
+	// Initialize AI context (load/update snapshots and memory index) in the background so the
+	// data API is served immediately; AI routes answer 503 until it is ready
+	controllers.StartContextInit()
 	// Setup Gin router with appropriate middleware
 	router := gin.New()
+	// Client IPs key the rate limits and visitor quotas, so X-Forwarded-For is only honoured from
+	// the proxies listed in TRUSTED_PROXIES (comma-separated IPs or CIDRs); without them the
+	// connection's remote address is used
+	proxies := trustedProxies()
+	if err := router.SetTrustedProxies(proxies); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES: ", err)
+	}
+	if len(proxies) == 0 {
+		log.Println("⚠️ TRUSTED_PROXIES is not set: behind a reverse proxy (e.g. Render) every visitor has the proxy's IP and shares one rate limit bucket and per-IP question quota. Set it to the proxy's address range (see render.yaml)")
+	}
 	// Global middleware: CORS configuration
 	router.Use(cors.New(cors.Config{
 		AllowOrigins: []string{
@@ -61,8 +84,12 @@ func main() {
 	// Attach metrics middleware to track requests and responses
 	router.Use(requestMetricsMiddleware)
 
-	// Define API routes
-	apiGroup := router.Group("/api")
+	// Readiness probe with per-component status
+	router.GET("/readyz", controllers.Readyz)
+
+	// Define API routes; each group has its own rate limit (see controllers.NewRateLimiter for
+	// the env overrides, RATE_LIMIT_STORE=mongo shares buckets across instances)
+	apiGroup := router.Group("/api", controllers.NewRateLimiter(controllers.RateLimit{Name: "api", Rate: 5, Burst: 60, Key: controllers.RateKeyIP}))
 	routes.RegisterDataRoutes(apiGroup)
 	aiGroup := router.Group("/api/ai")
 	routes.RegisterAiRoutes(aiGroup)
@@ -78,6 +105,17 @@ func main() {
 	}
 }
 
+// trustedProxies parses TRUSTED_PROXIES; nil trusts no proxy.
+func trustedProxies() []string {
+	var proxies []string
+	for _, p := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			proxies = append(proxies, p)
+		}
+	}
+	return proxies
+}
+
 // requestMetricsMiddleware measures request latency, collects metrics and logs hourly stats.
 func requestMetricsMiddleware(c *gin.Context) {
 	// before request
@@ -91,6 +129,8 @@ func requestMetricsMiddleware(c *gin.Context) {
 		route = c.Request.URL.Path
 	}
 	status := c.Writer.Status()
+	// Request pressure drives the proof-of-work difficulty of protected routes
+	controllers.ObserveRequestPressure(route)
 	ip := c.ClientIP()
 	uaString := c.Request.UserAgent()
 	ua := useragent.New(uaString)
@@ -200,6 +240,15 @@ func init() {
 				totalCalls, uniqueIPCount, rssPct, heapPct, cpuPct, handles, uptimeSec)
 			log.Printf("DB Conns: N/A | Ops: %d | DB Uptime: N/A | Storage: N/A | TopColl: %s(%d)",
 				dbOpsCount, topColl, maxOps)
+			// AI provider usage and estimated spend
+			aiUsage := controllers.TakeAIUsageReport()
+			log.Printf("AI Calls: %d | Tokens: %d in / %d out | Spend: $%.4f | TopModel: %s($%.4f)",
+				aiUsage.Calls, aiUsage.PromptTokens, aiUsage.CompletionTokens, aiUsage.Cost, aiUsage.TopModel, aiUsage.TopModelCost)
+			log.Println("Rate Limits:")
+			for _, rl := range controllers.TakeRateLimitReport() {
+				log.Printf("  %-8s %.2f/s burst %-4d by %-8s Allowed: %-6d Limited: %-6d Clients: %-4d Top: %s(%d)",
+					rl.Name, rl.Rate, rl.Burst, rl.Key, rl.Allowed, rl.Limited, rl.ClientCount, rl.TopClient, rl.TopLimited)
+			}
 			log.Println("Endpoints:")
 			if len(routeStats) == 0 {
 				log.Println("  (no calls)")
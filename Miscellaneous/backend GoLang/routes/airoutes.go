@@ -1,6 +1,8 @@
 package routes
 
 import (
+	"context"
+	"log"
 	"net/http"
 
 	"example.com/portfolio-backend/controllers"
@@ -9,6 +11,11 @@ import (
 
 // RegisterAiRoutes sets up all AI-related endpoints under /api/ai.
 func RegisterAiRoutes(router *gin.RouterGroup) {
+	// AI routes are rate limited per IP; sessions are client-chosen, so keying on them
+	// (RATE_LIMIT_AI_KEY=session) only suits deployments behind a shared IP
+	router.Use(controllers.NewRateLimiter(controllers.RateLimit{Name: "ai", Rate: 0.5, Burst: 20, Key: controllers.RateKeyIP}))
+	// Provider calls are accounted to the route they were made for
+	router.Use(controllers.TrackAIUsage)
 	// Basic test endpoint
 	router.GET("/", func(c *gin.Context) {
 		c.JSON(200, gin.H{"message": "AI Routes are working!"})
@@ -16,77 +23,168 @@ func RegisterAiRoutes(router *gin.RouterGroup) {
 	// Trigger manual (re)creation of context index and memory index
 	router.GET("/create-index", handleCreateIndex)
 	router.POST("/create-index", handleCreateIndex)
-	// Ask a question to the AI using indexed context
-	router.POST("/ask-chat", func(c *gin.Context) {
+	// Ask a question to the AI using indexed context; needs a solved proof-of-work challenge,
+	// counts against the visitor's question quota and is answered extractively once the spend
+	// budget is exhausted. It and the other routes that retrieve or call a model wait for the
+	// background context initialization (503 + Retry-After until then); admin config routes don't.
+	router.POST("/ask-chat", controllers.RequireAIReady, controllers.RequireProofOfWork("ask-chat"), controllers.BudgetGuard(true), func(c *gin.Context) {
 		var req struct {
-			Query string `json:"query"`
+			Query              string                               `json:"query"`
+			OriginalQuery      string                               `json:"originalQuery"` // the visitor's wording when query is the optimized rewrite
+			ConversationMemory string                               `json:"conversationMemory"`
+			Mode               string                               `json:"mode"`   // "rag" (default) or "tools"
+			Models             map[string]controllers.ModelOverride `json:"models"` // admin-only per-task model overrides
 		}
 		if err := c.BindJSON(&req); err != nil || req.Query == "" {
 			c.JSON(http.StatusBadRequest, gin.H{"message": "Query cannot be empty"})
 			return
 		}
-		answer, err := controllers.AskLLM(req.Query)
+		if req.Mode != "" && req.Mode != controllers.AnswerModeRAG && req.Mode != controllers.AnswerModeTools {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Mode must be rag or tools"})
+			return
+		}
+		ctx, ok := modelContext(c, req.Models)
+		if !ok {
+			return
+		}
+		result, err := controllers.AskLLM(controllers.WithOriginalQuery(ctx, req.OriginalQuery), req.Query, req.ConversationMemory, req.Mode)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			// Degraded mode already covers model outages, so this is rare; keep internals out of the response
+			log.Println("Error answering ask-chat query:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Sorry, I couldn't answer that right now. Please try again later."})
 		} else {
-			c.JSON(http.StatusOK, gin.H{"answer": answer})
+			c.JSON(http.StatusOK, result)
 		}
 	})
+	// Rate an ask-chat answer by its ID
+	router.POST("/feedback", controllers.PostFeedback)
+	// Admin-only: low-rated answers with their trace, and thumbs-down answers as golden set candidates
+	router.GET("/feedback", controllers.VerifyJWT, controllers.GetLowRatedAnswers)
+	router.GET("/feedback/export", controllers.VerifyJWT, controllers.ExportFeedbackGoldenSet)
+	// Admin-only: empty the semantic answer cache
+	router.DELETE("/answer-cache", controllers.VerifyJWT, controllers.PurgeAnswerCache)
+
+	// Admin-only: memory index versions and embedder migration status
+	router.GET("/memory-index/versions", controllers.VerifyJWT, controllers.GetMemoryIndexVersions)
+	// Owner persona templated into the prompts; readable by the chat widget, editable by the admin
+	router.GET("/persona", controllers.GetPersona)
+	router.PUT("/persona", controllers.VerifyJWT, controllers.PutPersona)
+	// Admin-only: per-task model profiles (answer, rewrite, followups, memory, embed, grade)
+	router.GET("/model-routing", controllers.VerifyJWT, controllers.GetModelRouting)
+	router.PUT("/model-routing", controllers.VerifyJWT, controllers.PutModelRouting)
+	// Admin-only: versioned prompt templates
+	router.GET("/prompts", controllers.VerifyJWT, controllers.GetPromptTemplates)
+	router.GET("/prompts/:name", controllers.VerifyJWT, controllers.GetPromptTemplate)
+	router.PUT("/prompts/:name", controllers.VerifyJWT, controllers.PutPromptTemplate)
+	router.POST("/prompts/:name/activate", controllers.VerifyJWT, controllers.ActivatePromptTemplate)
+	router.POST("/prompts/:name/preview", controllers.VerifyJWT, controllers.PreviewPromptTemplate)
+	// Admin-only: provider token usage and estimated cost, and the price table behind it
+	router.GET("/usage", controllers.VerifyJWT, controllers.GetAIUsage)
+	router.GET("/usage/prices", controllers.VerifyJWT, controllers.GetPriceTable)
+	router.PUT("/usage/prices", controllers.VerifyJWT, controllers.PutPriceTable)
+	// Admin-only: daily/monthly spend ceilings and per-visitor question quotas
+	router.GET("/budget", controllers.VerifyJWT, controllers.GetBudget)
+	router.PUT("/budget", controllers.VerifyJWT, controllers.PutBudget)
+	// Admin-only: prompt-injection and off-topic guardrail policy
+	router.GET("/guardrails", controllers.VerifyJWT, controllers.GetGuardrailPolicy)
+	router.PUT("/guardrails", controllers.VerifyJWT, controllers.PutGuardrailPolicy)
+	// Admin-only: PII/secret redaction applied to context snapshots and chunks
+	router.GET("/redaction-policy", controllers.VerifyJWT, controllers.GetRedactionPolicy)
+	router.PUT("/redaction-policy", controllers.VerifyJWT, controllers.PutRedactionPolicy)
+	// Admin-only: inspect the retrieval step of ask-chat without calling the chat model
+	router.POST("/debug-retrieve", controllers.VerifyJWT, controllers.RequireAIReady, controllers.DebugRetrieve)
+	// Admin-only: runtime-tunable retrieval profiles
+	router.GET("/retrieval-profiles", controllers.VerifyJWT, controllers.GetRetrievalProfiles)
+	router.GET("/retrieval-profiles/:name", controllers.VerifyJWT, controllers.GetRetrievalProfile)
+	router.PUT("/retrieval-profiles/:name", controllers.VerifyJWT, controllers.PutRetrievalProfile)
+	router.POST("/retrieval-profiles/:name/activate", controllers.VerifyJWT, controllers.ActivateRetrievalProfile)
 	// Get suggested follow-up questions
-	router.POST("/suggestFollowUpQuestions", func(c *gin.Context) {
+	router.POST("/suggestFollowUpQuestions", controllers.RequireAIReady, controllers.BudgetGuard(false), func(c *gin.Context) {
 		var req struct {
-			Query              string `json:"query"`
-			Response           string `json:"response"`
-			ConversationMemory string `json:"conversationMemory"`
+			Query              string                               `json:"query"`
+			Response           string                               `json:"response"`
+			ConversationMemory string                               `json:"conversationMemory"`
+			AskedQuestions     []string                             `json:"askedQuestions"` // earlier questions of the session, not suggested again
+			Models             map[string]controllers.ModelOverride `json:"models"`
 		}
 		if err := c.BindJSON(&req); err != nil || req.Query == "" || req.Response == "" {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Both query and response are required"})
 			return
 		}
-		suggestions, err := controllers.SuggestFollowUpQuestions(req.Query, req.Response, req.ConversationMemory)
+		ctx, ok := modelContext(c, req.Models)
+		if !ok {
+			return
+		}
+		suggestions, prompt, err := controllers.SuggestFollowUpQuestions(ctx, req.Query, req.Response, req.ConversationMemory, req.AskedQuestions)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		} else {
-			c.JSON(http.StatusOK, gin.H{"suggestions": suggestions})
+			c.JSON(http.StatusOK, gin.H{"suggestions": suggestions, "prompt": prompt})
 		}
 	})
 	// Update conversation memory snapshot
-	router.POST("/snapshotMemoryUpdate", func(c *gin.Context) {
+	router.POST("/snapshotMemoryUpdate", controllers.RequireAIReady, controllers.BudgetGuard(false), func(c *gin.Context) {
 		var req struct {
-			PreviousMemory string `json:"previousMemory"`
-			Query          string `json:"query"`
-			Response       string `json:"response"`
+			PreviousMemory string                               `json:"previousMemory"`
+			Query          string                               `json:"query"`
+			Response       string                               `json:"response"`
+			Models         map[string]controllers.ModelOverride `json:"models"`
 		}
 		if err := c.BindJSON(&req); err != nil || req.Query == "" || req.Response == "" {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Query and response are required"})
 			return
 		}
-		updatedMemory, err := controllers.SnapshotMemoryUpdate(req.PreviousMemory, req.Query, req.Response)
+		ctx, ok := modelContext(c, req.Models)
+		if !ok {
+			return
+		}
+		updatedMemory, prompt, err := controllers.SnapshotMemoryUpdate(ctx, req.PreviousMemory, req.Query, req.Response)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		} else {
-			c.JSON(http.StatusOK, gin.H{"memory": updatedMemory})
+			// memory is the opaque string the client sends back; structured is for display
+			c.JSON(http.StatusOK, gin.H{"memory": updatedMemory.Encode(), "structured": updatedMemory, "prompt": prompt})
 		}
 	})
 	// Optimize a query for better retrieval
-	router.POST("/optimize-query", func(c *gin.Context) {
+	router.POST("/optimize-query", controllers.RequireAIReady, controllers.BudgetGuard(false), func(c *gin.Context) {
 		var req struct {
-			Query              string `json:"query"`
-			ConversationMemory string `json:"conversationMemory"`
+			Query              string                               `json:"query"`
+			ConversationMemory string                               `json:"conversationMemory"`
+			Models             map[string]controllers.ModelOverride `json:"models"`
 		}
 		if err := c.BindJSON(&req); err != nil || req.Query == "" {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Query is required"})
 			return
 		}
-		optimized, err := controllers.OptimizeQuery(req.ConversationMemory, req.Query)
+		ctx, ok := modelContext(c, req.Models)
+		if !ok {
+			return
+		}
+		optimized, prompt, err := controllers.OptimizeQuery(ctx, req.ConversationMemory, req.Query)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		} else {
-			c.JSON(http.StatusOK, gin.H{"optimizedQuery": optimized})
+			c.JSON(http.StatusOK, gin.H{"optimizedQuery": optimized, "prompt": prompt})
 		}
 	})
 }
 
+// modelContext returns the request context with the admin's model overrides, answering 403 or
+// 400 itself when they are not allowed or invalid.
+func modelContext(c *gin.Context, overrides map[string]controllers.ModelOverride) (context.Context, bool) {
+	ctx, err := controllers.ModelOverrideContext(c, overrides)
+	if err == nil {
+		return ctx, true
+	}
+	if controllers.IsModelOverrideForbidden(err) {
+		c.JSON(http.StatusForbidden, gin.H{"message": err.Error()})
+	} else {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+	}
+	return nil, false
+}
+
 // handleCreateIndex triggers context file updates and memory index rebuild.
 func handleCreateIndex(c *gin.Context) {
 	if err := controllers.InitContext(); err != nil {
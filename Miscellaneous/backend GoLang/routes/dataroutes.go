@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"example.com/portfolio-backend/config"
 	"example.com/portfolio-backend/controllers"
 	"github.com/gin-gonic/gin"
 )
@@ -85,7 +86,10 @@ func RegisterDataRoutes(router *gin.RouterGroup) {
 	router.POST("/addFeed", controllers.VerifyJWT, controllers.AddFeed)
 	router.PUT("/updateFeed/:id", controllers.VerifyJWT, controllers.EditFeed)
 	router.DELETE("/deleteFeed/:id", controllers.VerifyJWT, controllers.DeleteFeed)
-	router.POST("/addLike", controllers.AddLike)
+	// Likes are anonymous, so each IP gets a small burst refilled one like per 10 seconds
+	router.POST("/addLike", controllers.NewRateLimiter(controllers.RateLimit{Name: "likes", Rate: 0.1, Burst: 5, Key: controllers.RateKeyIP}), controllers.RequireProofOfWork("like"), controllers.AddLike)
+	// Proof-of-work challenges for anonymous endpoints (?scope=like or ?scope=ask-chat)
+	router.GET("/pow/challenge", controllers.GetPowChallenge)
 
 	// Admin routes
 	router.POST("/setAdminCredentials", controllers.VerifyJWT, controllers.SetAdminCredentials)
@@ -103,7 +107,7 @@ func RegisterDataRoutes(router *gin.RouterGroup) {
 		collections := []string{
 			"skillsCollection", "skillsTable", "projectTable", "experienceTable",
 			"involvementTable", "honorsExperienceTable", "yearInReviewTable",
-			"KartavyaPortfolio", "FeedTable",
+			config.AdminCollection, "FeedTable",
 		}
 		result := make(map[string]int64)
 		for _, name := range collections {